@@ -0,0 +1,148 @@
+package postmark
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// BulkEmailMessage is a single recipient entry of a bulk request. Content is shared
+// across all entries, only the recipients, model and metadata vary.
+type BulkEmailMessage struct {
+	// To: REQUIRED Recipient email address. Multiple addresses are comma separated. Max 50.
+	To string `json:",omitempty"`
+	// Cc recipient email address. Multiple addresses are comma separated. Max 50.
+	Cc string `json:",omitempty"`
+	// Bcc recipient email address. Multiple addresses are comma separated. Max 50.
+	Bcc string `json:",omitempty"`
+	// TemplateModel: The model applied to the shared Subject, HtmlBody and TextBody for this recipient.
+	TemplateModel map[string]interface{} `json:",omitempty"`
+	// Metadata: Custom metadata key/value pairs for this recipient.
+	Metadata map[string]string `json:",omitempty"`
+}
+
+// BulkEmail is the request body for SendBulkEmail
+// https://postmarkapp.com/developer/api/bulk-email
+type BulkEmail struct {
+	// From: REQUIRED The sender email address. Must have a registered and confirmed Sender Signature.
+	From string `json:",omitempty"`
+	// Subject: Email subject
+	Subject string `json:",omitempty"`
+	// HTMLBody: HTML email message. REQUIRED, If no TextBody specified
+	HTMLBody string `json:"HtmlBody,omitempty"`
+	// TextBody: Plain text email message. REQUIRED, If no HTMLBody specified
+	TextBody string `json:",omitempty"`
+	// ReplyTo: Reply To override email address. Defaults to the Reply To set in the sender signature.
+	ReplyTo string `json:",omitempty"`
+	// Tag: Email tag that allows you to categorize outgoing emails and get detailed statistics.
+	Tag string `json:",omitempty"`
+	// Headers: List of custom headers to include.
+	Headers []Header `json:",omitempty"`
+	// TrackOpens: Activate open tracking for this email.
+	TrackOpens bool `json:",omitempty"`
+	// TrackLinks: Activate link tracking. Possible options: "None", "HtmlAndText", "HtmlOnly", "TextOnly".
+	TrackLinks string `json:",omitempty"`
+	// Attachments: List of attachments
+	Attachments []Attachment `json:",omitempty"`
+	// Metadata: metadata shared by every message in the request
+	Metadata map[string]string `json:",omitempty"`
+	// MessageStream: REQUIRED The broadcast message stream to send through.
+	MessageStream string `json:",omitempty"`
+	// Messages: REQUIRED Per-recipient entries.
+	Messages []BulkEmailMessage `json:",omitempty"`
+}
+
+// BulkEmailStatusType is the processing state of a bulk request.
+type BulkEmailStatusType string
+
+const (
+	// BulkEmailAccepted means the request was queued but processing has not started.
+	BulkEmailAccepted BulkEmailStatusType = "Accepted"
+	// BulkEmailProcessing means messages are being sent.
+	BulkEmailProcessing BulkEmailStatusType = "Processing"
+	// BulkEmailCompleted means every message in the request was processed.
+	BulkEmailCompleted BulkEmailStatusType = "Completed"
+)
+
+// BulkEmailResponse is returned when a bulk request is accepted
+type BulkEmailResponse struct {
+	// ID of the bulk request, used with GetBulkEmailStatus
+	ID string `json:"ID"`
+	// Status of the bulk request
+	Status BulkEmailStatusType
+	// SubmittedAt: Timestamp
+	SubmittedAt time.Time
+}
+
+// BulkEmailStatus describes the progress of a bulk request
+type BulkEmailStatus struct {
+	// ID of the bulk request
+	ID string `json:"Id"`
+	// SubmittedAt: Timestamp
+	SubmittedAt time.Time
+	// TotalMessages: Number of messages in the request
+	TotalMessages int64
+	// PercentageCompleted: Processing progress, from 0 to 100
+	PercentageCompleted float64
+	// Status of the bulk request
+	Status BulkEmailStatusType
+}
+
+// SendBulkEmail submits a bulk request. Messages are sent asynchronously, use
+// GetBulkEmailStatus or WaitForBulk with the returned ID to follow progress.
+func (client *Client) SendBulkEmail(ctx context.Context, email BulkEmail) (BulkEmailResponse, error) {
+	res := BulkEmailResponse{}
+	err := client.doRequest(ctx, parameters{
+		Method:    http.MethodPost,
+		Path:      "email/bulk",
+		Payload:   email,
+		TokenType: serverToken,
+	}, &res)
+	return res, err
+}
+
+// GetBulkEmailStatus fetches the status of a bulk request via bulkRequestID
+func (client *Client) GetBulkEmailStatus(ctx context.Context, bulkRequestID string) (BulkEmailStatus, error) {
+	res := BulkEmailStatus{}
+	err := client.doRequest(ctx, parameters{
+		Method:    http.MethodGet,
+		Path:      fmt.Sprintf("email/bulk/%s", bulkRequestID),
+		TokenType: serverToken,
+	}, &res)
+	return res, err
+}
+
+// defaultBulkPollInterval is used by WaitForBulk when no interval is given
+const defaultBulkPollInterval = 5 * time.Second
+
+// WaitForBulk polls GetBulkEmailStatus every interval until the bulk request is
+// completed or ctx is done. If progress is not nil it is called with every status
+// received, so callers can report PercentageCompleted.
+func (client *Client) WaitForBulk(ctx context.Context, bulkRequestID string, interval time.Duration, progress func(BulkEmailStatus)) (BulkEmailStatus, error) {
+	if interval <= 0 {
+		interval = defaultBulkPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		status, err := client.GetBulkEmailStatus(ctx, bulkRequestID)
+		if err != nil {
+			return status, err
+		}
+		if progress != nil {
+			progress(status)
+		}
+		if status.Status == BulkEmailCompleted {
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
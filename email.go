@@ -78,6 +78,13 @@ type EmailResponse struct {
 // SendEmail sends, well, an email.
 func (client *Client) SendEmail(ctx context.Context, email Email) (EmailResponse, error) {
 	res := EmailResponse{}
+	if client.GenerateTextBody {
+		var err error
+		if email, err = email.WithGeneratedTextBody(); err != nil {
+			return res, err
+		}
+	}
+
 	err := client.doRequest(ctx, parameters{
 		Method:    "POST",
 		Path:      "email",
@@ -97,6 +104,17 @@ func (client *Client) SendEmail(ctx context.Context, email Email) (EmailResponse
 // range over the responses and sniff for errors
 func (client *Client) SendEmailBatch(ctx context.Context, emails []Email) ([]EmailResponse, error) {
 	var res []EmailResponse
+	if client.GenerateTextBody {
+		generated := make([]Email, len(emails))
+		for i, email := range emails {
+			var err error
+			if generated[i], err = email.WithGeneratedTextBody(); err != nil {
+				return res, err
+			}
+		}
+		emails = generated
+	}
+
 	err := client.doRequest(ctx, parameters{
 		Method:    "POST",
 		Path:      "email/batch",
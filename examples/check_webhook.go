@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/zyghq/postmark"
+)
+
+// Test-fires the webhooks with the given IDs, sending a sample payload for
+// each enabled trigger, and exits with status 1 when an endpoint rejects one.
+func main() {
+	flag.Parse()
+
+	client := postmark.NewClient("[SERVER-TOKEN]", "[ACCOUNT-TOKEN]")
+
+	healthy := true
+	for _, arg := range flag.Args() {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		report, err := client.CheckWebhook(context.Background(), id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(report)
+		healthy = healthy && report.Healthy()
+	}
+
+	if !healthy {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/zyghq/postmark"
+)
+
+// Serves a preview of the server templates, or of a local template directory
+// with -dir, reloading pages when its files change.
+func main() {
+	addr := flag.String("addr", "localhost:8025", "address to listen on")
+	dir := flag.String("dir", "", "local template directory")
+	flag.Parse()
+
+	client := postmark.NewClient("[SERVER-TOKEN]", "[ACCOUNT-TOKEN]")
+
+	http.Handle("/templates/", http.StripPrefix("/templates", postmark.NewTemplatePreviewHandler(client, *dir)))
+	log.Printf("previewing templates on http://%s/templates/", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
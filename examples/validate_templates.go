@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/zyghq/postmark"
+)
+
+// Validates a template directory, or a directory of templates, printing
+// file:line:col diagnostics. With -ci the exit status is 1 on errors, and with
+// -strict on warnings as well.
+func main() {
+	ci := flag.Bool("ci", false, "exit with status 1 when errors are found")
+	strict := flag.Bool("strict", false, "treat warnings as errors")
+	flag.Parse()
+
+	client := postmark.NewClient("[SERVER-TOKEN]", "[ACCOUNT-TOKEN]")
+	validator := postmark.TemplateValidator{Client: client}
+
+	failed := false
+	for _, path := range flag.Args() {
+		report, err := validator.Validate(context.Background(), path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(report)
+		failed = failed || report.Failed(*strict)
+	}
+
+	if *ci && failed {
+		os.Exit(1)
+	}
+}
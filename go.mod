@@ -1,3 +1,8 @@
 module github.com/zyghq/postmark
 
-go 1.23
+go 1.23.0
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.22
+	golang.org/x/net v0.43.0
+)
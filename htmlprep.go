@@ -0,0 +1,552 @@
+package postmark
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// GmailClipThreshold is the HTML size above which Gmail clips messages behind a
+// "View entire message" link
+const GmailClipThreshold = 102 * 1024
+
+// unsupportedCSS lists CSS features with poor support across major email clients.
+// Properties are anchored at the start of a declaration, and functions at the
+// start of a value, so that background-position or text-transform do not match.
+// Vendor prefixed properties match as well.
+var unsupportedCSS = []struct {
+	pattern *regexp.Regexp
+	feature string
+}{
+	{regexp.MustCompile(`(?i)(^|[;{\s])(-[a-z]+-)?position\s*:`), "position"},
+	{regexp.MustCompile(`(?i)(^|[;{\s])(-[a-z]+-)?display\s*:\s*(inline-)?(flex|grid)\b`), "flexbox and grid layout"},
+	{regexp.MustCompile(`(?i)(^|[;{\s])(-[a-z]+-)?(flex|grid)(-[a-z]+)?\s*:`), "flexbox and grid properties"},
+	{regexp.MustCompile(`(?i)(^|[;{\s])(-[a-z]+-)?box-shadow\s*:`), "box-shadow"},
+	{regexp.MustCompile(`(?i)(^|[;{\s])(-[a-z]+-)?transform\s*:`), "transform"},
+	{regexp.MustCompile(`(?i)(^|[;{\s])(-[a-z]+-)?(animation|transition)(-[a-z]+)?\s*:`), "animations and transitions"},
+	{regexp.MustCompile(`(?i)(^|[:,(\s])var\(`), "CSS variables"},
+	{regexp.MustCompile(`(?i)(^|[:,(\s])calc\(`), "calc()"},
+	{regexp.MustCompile(`(?i)(^|[;{}\s])@import\b`), "@import"},
+	{regexp.MustCompile(`(?i)(^|[;{}\s])@font-face\b`), "@font-face"},
+}
+
+// PreflightOptions configures PreflightHTML
+type PreflightOptions struct {
+	// BaseURL, when set, is used to resolve relative image URLs
+	BaseURL string
+	// KeepStyleBlocks keeps the <style> blocks after inlining. Rules which cannot be
+	// inlined (media queries, pseudo-classes) are always kept.
+	KeepStyleBlocks bool
+}
+
+// PreflightWarning is an issue found in the HTML
+type PreflightWarning struct {
+	// Message describes the issue
+	Message string
+	// Element is a short description of the offending element, if any
+	Element string
+}
+
+// String formats the warning for display
+func (w PreflightWarning) String() string {
+	if w.Element == "" {
+		return w.Message
+	}
+	return w.Element + ": " + w.Message
+}
+
+// PreflightResult is the outcome of PreflightHTML
+type PreflightResult struct {
+	// HTML with CSS inlined and image URLs rewritten
+	HTML string
+	// Warnings about unsupported CSS and missing alt attributes
+	Warnings []PreflightWarning
+	// Size of HTML in bytes
+	Size int
+	// Clipped reports whether Size exceeds GmailClipThreshold
+	Clipped bool
+}
+
+// PreflightHTML prepares an HTML body for sending. Rules from <style> blocks are
+// inlined into style attributes, relative image URLs are resolved against
+// opts.BaseURL, and warnings are reported for CSS with poor email client support
+// and images without an alt attribute. Postmark only inlines CSS for templates,
+// so this is useful before SendEmail.
+func PreflightHTML(htmlBody string, opts PreflightOptions) (PreflightResult, error) {
+	res := PreflightResult{}
+
+	var base *url.URL
+	if opts.BaseURL != "" {
+		var err error
+		if base, err = url.Parse(opts.BaseURL); err != nil {
+			return res, fmt.Errorf("postmark: invalid base URL: %w", err)
+		}
+	}
+
+	doc, err := html.Parse(strings.NewReader(htmlBody))
+	if err != nil {
+		return res, err
+	}
+
+	var styles []*html.Node
+	var elements []*html.Node
+	walkHTML(doc, func(n *html.Node) {
+		if n.Type != html.ElementNode {
+			return
+		}
+		switch n.DataAtom {
+		case atom.Style:
+			styles = append(styles, n)
+			return
+		case atom.Img:
+			if _, ok := htmlAttrOK(n, "alt"); !ok {
+				res.Warnings = append(res.Warnings, PreflightWarning{Message: "missing alt attribute", Element: describeHTMLNode(n)})
+			}
+			rewriteHTMLURL(n, "src", base)
+		}
+		if _, ok := htmlAttrOK(n, "background"); ok {
+			rewriteHTMLURL(n, "background", base)
+		}
+		if style, ok := htmlAttrOK(n, "style"); ok {
+			res.Warnings = append(res.Warnings, cssWarnings(style, describeHTMLNode(n))...)
+		}
+		elements = append(elements, n)
+	})
+
+	var rules []cssRule
+	var kept []string
+	for _, style := range styles {
+		css := htmlText(style)
+		res.Warnings = append(res.Warnings, cssWarnings(css, "<style>")...)
+		inlinable, rest := parseCSS(css, len(rules))
+		rules = append(rules, inlinable...)
+		kept = append(kept, rest...)
+	}
+	inlineCSS(elements, rules)
+
+	if !opts.KeepStyleBlocks {
+		for _, style := range styles {
+			style.Parent.RemoveChild(style)
+		}
+	}
+	if !opts.KeepStyleBlocks && len(kept) > 0 {
+		style := &html.Node{Type: html.ElementNode, Data: "style", DataAtom: atom.Style}
+		style.AppendChild(&html.Node{Type: html.TextNode, Data: strings.Join(kept, "\n")})
+		appendToHead(doc, style)
+	}
+
+	var buf bytes.Buffer
+	if err = html.Render(&buf, doc); err != nil {
+		return res, err
+	}
+	res.HTML = buf.String()
+	res.Size = len(res.HTML)
+	res.Clipped = res.Size > GmailClipThreshold
+	if res.Clipped {
+		res.Warnings = append(res.Warnings, PreflightWarning{
+			Message: fmt.Sprintf("HTML is %d bytes, Gmail clips messages above %d bytes", res.Size, GmailClipThreshold),
+		})
+	}
+	return res, nil
+}
+
+// WithPreflight returns a copy of the email with HTMLBody replaced by the output of PreflightHTML
+func (email Email) WithPreflight(opts PreflightOptions) (Email, PreflightResult, error) {
+	if email.HTMLBody == "" {
+		return email, PreflightResult{}, nil
+	}
+	res, err := PreflightHTML(email.HTMLBody, opts)
+	if err != nil {
+		return email, res, err
+	}
+	email.HTMLBody = res.HTML
+	return email, res, nil
+}
+
+// cssWarnings reports the unsupported CSS features used in css
+func cssWarnings(css, element string) []PreflightWarning {
+	var warnings []PreflightWarning
+	for _, u := range unsupportedCSS {
+		if u.pattern.MatchString(css) {
+			warnings = append(warnings, PreflightWarning{
+				Message: u.feature + " is not supported by all email clients",
+				Element: element,
+			})
+		}
+	}
+	return warnings
+}
+
+// cssRule is a style rule with a single selector
+type cssRule struct {
+	selector     []cssCompound
+	specificity  [3]int
+	order        int
+	declarations []cssDeclaration
+}
+
+type cssDeclaration struct {
+	property  string
+	value     string
+	important bool
+}
+
+// cssCompound is a compound selector such as a.button#main, with the combinator
+// linking it to the previous compound (' ' for descendant, '>' for child)
+type cssCompound struct {
+	combinator byte
+	tag        string
+	id         string
+	classes    []string
+}
+
+var cssComments = regexp.MustCompile(`(?s)/\*.*?\*/`)
+
+// parseCSS splits a stylesheet into inlinable rules, and the text of rules which
+// cannot be inlined such as at-rules and selectors with pseudo-classes
+func parseCSS(css string, order int) ([]cssRule, []string) {
+	css = cssComments.ReplaceAllString(css, "")
+
+	var rules []cssRule
+	var kept []string
+	for {
+		css = strings.TrimSpace(css)
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			break
+		}
+		prelude := strings.TrimSpace(css[:open])
+		end := matchingBrace(css, open)
+		block := css[open+1 : end]
+		raw := css[:min(end+1, len(css))]
+		css = css[min(end+1, len(css)):]
+
+		if strings.HasPrefix(prelude, "@") {
+			kept = append(kept, raw)
+			continue
+		}
+
+		declarations := parseCSSDeclarations(block)
+		var keptSelectors []string
+		for _, sel := range strings.Split(prelude, ",") {
+			sel = strings.TrimSpace(sel)
+			compounds, specificity, ok := parseCSSSelector(sel)
+			if !ok {
+				keptSelectors = append(keptSelectors, sel)
+				continue
+			}
+			rules = append(rules, cssRule{selector: compounds, specificity: specificity, order: order, declarations: declarations})
+			order++
+		}
+		if len(keptSelectors) > 0 {
+			kept = append(kept, strings.Join(keptSelectors, ", ")+" {"+block+"}")
+		}
+	}
+	return rules, kept
+}
+
+// matchingBrace returns the index of the brace closing the one at open
+func matchingBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+// parseCSSDeclarations parses "color: red; background: url(a;b)" into declarations
+func parseCSSDeclarations(block string) []cssDeclaration {
+	var declarations []cssDeclaration
+	depth := 0
+	var quote byte
+	start := 0
+	flush := func(end int) {
+		decl := strings.TrimSpace(block[start:end])
+		start = end + 1
+		colon := strings.IndexByte(decl, ':')
+		if colon <= 0 {
+			return
+		}
+		d := cssDeclaration{
+			property: strings.ToLower(strings.TrimSpace(decl[:colon])),
+			value:    strings.TrimSpace(decl[colon+1:]),
+		}
+		if i := strings.LastIndex(strings.ToLower(d.value), "!important"); i >= 0 {
+			d.important = true
+			d.value = strings.TrimSpace(d.value[:i])
+		}
+		declarations = append(declarations, d)
+	}
+	for i := 0; i < len(block); i++ {
+		c := block[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ';' && depth == 0:
+			flush(i)
+		}
+	}
+	flush(len(block))
+	return declarations
+}
+
+var (
+	cssCompoundPattern       = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9-]*|\*)?((?:[.#][a-zA-Z_-][a-zA-Z0-9_-]*)*)$`)
+	cssSimpleSelectorPattern = regexp.MustCompile(`[.#][^.#]+`)
+)
+
+// parseCSSSelector parses a selector made of type, class and id selectors joined by
+// descendant or child combinators. Other selectors are reported as not inlinable.
+func parseCSSSelector(sel string) ([]cssCompound, [3]int, bool) {
+	var specificity [3]int
+	if sel == "" {
+		return nil, specificity, false
+	}
+
+	tokens := strings.Fields(strings.ReplaceAll(sel, ">", " > "))
+	var compounds []cssCompound
+	combinator := byte(' ')
+	for _, token := range tokens {
+		if token == ">" {
+			if len(compounds) == 0 || combinator == '>' {
+				return nil, specificity, false
+			}
+			combinator = '>'
+			continue
+		}
+
+		m := cssCompoundPattern.FindStringSubmatch(token)
+		if m == nil || (m[1] == "" && m[2] == "") {
+			return nil, specificity, false
+		}
+		c := cssCompound{combinator: combinator, tag: strings.ToLower(m[1])}
+		if c.tag != "" && c.tag != "*" {
+			specificity[2]++
+		}
+		for _, part := range cssSimpleSelectorPattern.FindAllString(m[2], -1) {
+			if part[0] == '#' {
+				c.id = part[1:]
+				specificity[0]++
+			} else {
+				c.classes = append(c.classes, part[1:])
+				specificity[1]++
+			}
+		}
+		compounds = append(compounds, c)
+		combinator = ' '
+	}
+	if combinator == '>' {
+		return nil, specificity, false
+	}
+	return compounds, specificity, len(compounds) > 0
+}
+
+// matches reports whether the selector matches n
+func (r cssRule) matches(n *html.Node) bool {
+	return matchCSSCompounds(n, r.selector)
+}
+
+func matchCSSCompounds(n *html.Node, compounds []cssCompound) bool {
+	last := compounds[len(compounds)-1]
+	if !last.matches(n) {
+		return false
+	}
+	if len(compounds) == 1 {
+		return true
+	}
+
+	rest := compounds[:len(compounds)-1]
+	for p := n.Parent; p != nil && p.Type == html.ElementNode; p = p.Parent {
+		if matchCSSCompounds(p, rest) {
+			return true
+		}
+		if last.combinator == '>' {
+			return false
+		}
+	}
+	return false
+}
+
+func (c cssCompound) matches(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if c.tag != "" && c.tag != "*" && c.tag != n.Data {
+		return false
+	}
+	if c.id != "" && htmlAttr(n, "id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		classes := strings.Fields(htmlAttr(n, "class"))
+		for _, want := range c.classes {
+			found := false
+			for _, class := range classes {
+				if class == want {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// inlineCSS applies rules to the style attribute of elements. Existing inline
+// declarations win over rules, unless the rule declaration is !important.
+func inlineCSS(elements []*html.Node, rules []cssRule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		a, b := rules[i], rules[j]
+		if a.specificity != b.specificity {
+			for k := range a.specificity {
+				if a.specificity[k] != b.specificity[k] {
+					return a.specificity[k] < b.specificity[k]
+				}
+			}
+		}
+		return a.order < b.order
+	})
+
+	for _, n := range elements {
+		var matched []cssDeclaration
+		for _, rule := range rules {
+			if rule.matches(n) {
+				matched = append(matched, rule.declarations...)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+
+		inline := parseCSSDeclarations(htmlAttr(n, "style"))
+		var order []string
+		values := map[string]cssDeclaration{}
+		set := func(d cssDeclaration) {
+			if prev, ok := values[d.property]; ok && prev.important && !d.important {
+				return
+			}
+			if _, ok := values[d.property]; !ok {
+				order = append(order, d.property)
+			}
+			values[d.property] = d
+		}
+		for _, d := range matched {
+			set(d)
+		}
+		for _, d := range inline {
+			set(d)
+		}
+
+		parts := make([]string, 0, len(order))
+		for _, property := range order {
+			d := values[property]
+			value := d.value
+			if d.important {
+				value += " !important"
+			}
+			parts = append(parts, property+": "+value)
+		}
+		setHTMLAttr(n, "style", strings.Join(parts, "; "))
+	}
+}
+
+// rewriteHTMLURL resolves a relative URL attribute against base
+func rewriteHTMLURL(n *html.Node, key string, base *url.URL) {
+	if base == nil {
+		return
+	}
+	value, ok := htmlAttrOK(n, key)
+	if !ok || value == "" {
+		return
+	}
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil || u.IsAbs() || strings.Contains(value, "{{") {
+		return
+	}
+	setHTMLAttr(n, key, base.ResolveReference(u).String())
+}
+
+func walkHTML(n *html.Node, fn func(n *html.Node)) {
+	fn(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkHTML(c, fn)
+	}
+}
+
+func htmlAttrOK(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func setHTMLAttr(n *html.Node, key, value string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: value})
+}
+
+// htmlText returns the concatenated text of the children of n
+func htmlText(n *html.Node) string {
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			sb.WriteString(c.Data)
+		}
+	}
+	return sb.String()
+}
+
+// appendToHead appends n to the <head> of doc
+func appendToHead(doc *html.Node, n *html.Node) {
+	var head *html.Node
+	walkHTML(doc, func(c *html.Node) {
+		if head == nil && c.Type == html.ElementNode && c.DataAtom == atom.Head {
+			head = c
+		}
+	})
+	if head != nil {
+		head.AppendChild(n)
+	}
+}
+
+// describeHTMLNode returns a short description such as <img src="logo.png">
+func describeHTMLNode(n *html.Node) string {
+	for _, key := range []string{"id", "src", "class", "href"} {
+		if v, ok := htmlAttrOK(n, key); ok && v != "" {
+			return fmt.Sprintf("<%s %s=%q>", n.Data, key, v)
+		}
+	}
+	return "<" + n.Data + ">"
+}
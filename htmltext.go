@@ -0,0 +1,277 @@
+package postmark
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLToText derives a readable plain text version of an HTML body. Links are
+// rendered as "text (url)", list items as bullets or numbers, table rows on
+// one line, headings underlined, and <style>, <script> and <head> are dropped.
+func HTMLToText(htmlBody string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(htmlBody))
+	if err != nil {
+		return "", err
+	}
+
+	w := &textWriter{}
+	w.node(doc)
+	return w.String(), nil
+}
+
+// WithGeneratedTextBody returns a copy of the email with TextBody derived from
+// HTMLBody when TextBody is empty
+func (email Email) WithGeneratedTextBody() (Email, error) {
+	if email.TextBody != "" || email.HTMLBody == "" {
+		return email, nil
+	}
+	text, err := HTMLToText(email.HTMLBody)
+	email.TextBody = text
+	return email, err
+}
+
+// WithGeneratedTextBody returns a copy of the template with TextBody derived from
+// HTMLBody when TextBody is empty. Template placeholders are kept as they are.
+func (template Template) WithGeneratedTextBody() (Template, error) {
+	if template.TextBody != "" || template.HTMLBody == "" {
+		return template, nil
+	}
+	text, err := HTMLToText(template.HTMLBody)
+	template.TextBody = text
+	return template, err
+}
+
+// textWriter accumulates plain text, collapsing whitespace and blank lines
+type textWriter struct {
+	sb        strings.Builder
+	newlines  int
+	space     bool
+	lineStart bool
+	indent    string
+	pre       int
+	lists     []*listState
+}
+
+type listState struct {
+	ordered bool
+	index   int
+}
+
+func (w *textWriter) String() string {
+	lines := strings.Split(w.sb.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// block requests n line breaks before the next content
+func (w *textWriter) block(n int) {
+	if w.sb.Len() == 0 {
+		return
+	}
+	w.newlines = max(w.newlines, n)
+	w.space = false
+}
+
+// write writes content as is, after any pending line breaks or space
+func (w *textWriter) write(s string) {
+	if s == "" {
+		return
+	}
+	if w.newlines > 0 {
+		w.sb.WriteString(strings.Repeat("\n", min(w.newlines, 2)))
+		w.newlines = 0
+		w.lineStart = true
+	}
+	if w.lineStart {
+		w.sb.WriteString(w.indent)
+		w.lineStart = false
+		w.space = false
+	}
+	if w.space {
+		if str := w.sb.String(); str != "" && !isHTMLSpace(str[len(str)-1]) {
+			w.sb.WriteByte(' ')
+		}
+		w.space = false
+	}
+	w.sb.WriteString(s)
+}
+
+// text writes a text node, collapsing whitespace outside of <pre>
+func (w *textWriter) text(s string) {
+	if w.pre > 0 {
+		for i, line := range strings.Split(s, "\n") {
+			if i > 0 {
+				w.newlines++
+			}
+			w.write(line)
+		}
+		return
+	}
+
+	if s != "" && isHTMLSpace(s[0]) && w.sb.Len() > 0 {
+		w.space = true
+	}
+	words := strings.Fields(s)
+	for i, word := range words {
+		if i > 0 {
+			w.space = true
+		}
+		w.write(word)
+	}
+	if len(words) > 0 && isHTMLSpace(s[len(s)-1]) {
+		w.space = true
+	}
+}
+
+func (w *textWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+}
+
+// inline renders the children of n on their own, for content which needs post processing
+func (w *textWriter) inline(n *html.Node) string {
+	sub := &textWriter{}
+	sub.children(n)
+	return strings.Join(strings.Fields(sub.String()), " ")
+}
+
+func (w *textWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.DocumentNode:
+		w.children(n)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Head, atom.Style, atom.Script, atom.Title, atom.Noscript, atom.Template:
+		return
+	case atom.Br:
+		w.newlines++
+		w.space = false
+		if w.sb.Len() == 0 {
+			w.newlines = 0
+		}
+	case atom.Hr:
+		w.block(2)
+		w.write(strings.Repeat("-", 40))
+		w.block(2)
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		heading := w.inline(n)
+		if heading == "" {
+			return
+		}
+		underline := "-"
+		if n.DataAtom == atom.H1 {
+			underline = "="
+		}
+		w.block(2)
+		w.write(heading)
+		w.block(1)
+		w.write(strings.Repeat(underline, len([]rune(heading))))
+		w.block(2)
+	case atom.A:
+		w.link(n)
+	case atom.Img:
+		if alt := strings.TrimSpace(htmlAttr(n, "alt")); alt != "" {
+			w.write(alt)
+		}
+	case atom.Ul, atom.Ol:
+		w.block(1)
+		if len(w.lists) == 0 {
+			w.block(2)
+		}
+		w.lists = append(w.lists, &listState{ordered: n.DataAtom == atom.Ol})
+		w.children(n)
+		w.lists = w.lists[:len(w.lists)-1]
+		w.block(1)
+		if len(w.lists) == 0 {
+			w.block(2)
+		}
+	case atom.Li:
+		w.listItem(n)
+	case atom.Tr:
+		w.block(1)
+		w.children(n)
+		w.block(1)
+	case atom.Td, atom.Th:
+		w.space = true
+		w.children(n)
+		w.space = true
+	case atom.Pre:
+		w.block(2)
+		w.pre++
+		w.children(n)
+		w.pre--
+		w.block(2)
+	case atom.P, atom.Div, atom.Table, atom.Blockquote, atom.Section, atom.Article,
+		atom.Header, atom.Footer, atom.Main, atom.Nav, atom.Aside, atom.Address,
+		atom.Dl, atom.Dt, atom.Dd, atom.Figure, atom.Figcaption, atom.Center, atom.Form:
+		newlines := 2
+		if n.DataAtom == atom.Div || n.DataAtom == atom.Dt || n.DataAtom == atom.Dd {
+			newlines = 1
+		}
+		w.block(newlines)
+		w.children(n)
+		w.block(newlines)
+	default:
+		w.children(n)
+	}
+}
+
+func (w *textWriter) link(n *html.Node) {
+	text := w.inline(n)
+	href := strings.TrimSpace(htmlAttr(n, "href"))
+	target := strings.TrimPrefix(href, "mailto:")
+
+	switch {
+	case href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:"):
+		w.write(text)
+	case text == "" || text == href || text == target:
+		w.write(target)
+	default:
+		w.write(text + " (" + target + ")")
+	}
+}
+
+func (w *textWriter) listItem(n *html.Node) {
+	bullet := "* "
+	depth := len(w.lists)
+	if depth > 0 {
+		list := w.lists[depth-1]
+		list.index++
+		if list.ordered {
+			bullet = strconv.Itoa(list.index) + ". "
+		}
+	}
+
+	w.block(1)
+	outer := w.indent
+	base := strings.Repeat("  ", max(depth-1, 0))
+	w.indent = base
+	w.write(bullet)
+	w.indent = base + strings.Repeat(" ", len(bullet))
+	w.children(n)
+	w.indent = outer
+	w.block(1)
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	value, _ := htmlAttrOK(n, key)
+	return value
+}
+
+func isHTMLSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
@@ -0,0 +1,220 @@
+package postmark
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// IdempotencyMetadataKey is the Metadata key IdempotentSender stamps the idempotency key into
+const IdempotencyMetadataKey = "idempotency_key"
+
+// IdempotencyStore keeps the response of every successful send by idempotency key
+type IdempotencyStore interface {
+	// Get returns the stored response for key, and whether it was found
+	Get(ctx context.Context, key string) (EmailResponse, bool, error)
+	// Put stores the response for key
+	Put(ctx context.Context, key string, res EmailResponse) error
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore kept in memory, entries expire after TTL.
+type MemoryIdempotencyStore struct {
+	// TTL is how long responses are kept, 24 hours by default
+	TTL time.Duration
+	// Now returns the current time, time.Now by default
+	Now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]idempotencyEntry
+}
+
+type idempotencyEntry struct {
+	res       EmailResponse
+	expiresAt time.Time
+}
+
+var _ IdempotencyStore = (*MemoryIdempotencyStore)(nil)
+
+// NewMemoryIdempotencyStore builds an empty MemoryIdempotencyStore with the given TTL
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{TTL: ttl}
+}
+
+// Get returns the stored response for key if it has not expired
+func (store *MemoryIdempotencyStore) Get(_ context.Context, key string) (EmailResponse, bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	entry, ok := store.entries[key]
+	if !ok {
+		return EmailResponse{}, false, nil
+	}
+	if !store.now().Before(entry.expiresAt) {
+		delete(store.entries, key)
+		return EmailResponse{}, false, nil
+	}
+	return entry.res, true, nil
+}
+
+// Put stores the response for key, and drops expired entries
+func (store *MemoryIdempotencyStore) Put(_ context.Context, key string, res EmailResponse) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := store.now()
+	if store.entries == nil {
+		store.entries = map[string]idempotencyEntry{}
+	}
+	for k, entry := range store.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(store.entries, k)
+		}
+	}
+
+	ttl := store.TTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	store.entries[key] = idempotencyEntry{res: res, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (store *MemoryIdempotencyStore) now() time.Time {
+	if store.Now != nil {
+		return store.Now()
+	}
+	return time.Now()
+}
+
+// IdempotentSender wraps a Sender so that repeated sends with the same idempotency
+// key return the first response instead of sending the email again. The key is
+// stamped into the email Metadata, so Reconcile can find out whether an attempt
+// that failed ambiguously (a timeout for instance) was actually sent.
+type IdempotentSender struct {
+	// Sender sends the emails, usually a *Client
+	Sender Sender
+	// Store keeps the responses by key
+	Store IdempotencyStore
+
+	locks keyedLocks
+}
+
+// NewIdempotentSender builds an IdempotentSender
+func NewIdempotentSender(sender Sender, store IdempotencyStore) *IdempotentSender {
+	return &IdempotentSender{Sender: sender, Store: store}
+}
+
+// SendEmail sends email unless a response was already stored for key
+func (sender *IdempotentSender) SendEmail(ctx context.Context, key string, email Email) (EmailResponse, error) {
+	metadata := make(map[string]string, len(email.Metadata)+1)
+	for k, v := range email.Metadata {
+		metadata[k] = v
+	}
+	metadata[IdempotencyMetadataKey] = key
+	email.Metadata = metadata
+
+	return sender.send(ctx, key, func() (EmailResponse, error) {
+		return sender.Sender.SendEmail(ctx, email)
+	})
+}
+
+// SendTemplatedEmail sends email unless a response was already stored for key
+func (sender *IdempotentSender) SendTemplatedEmail(ctx context.Context, key string, email TemplatedEmail) (EmailResponse, error) {
+	metadata := make(map[string]interface{}, len(email.Metadata)+1)
+	for k, v := range email.Metadata {
+		metadata[k] = v
+	}
+	metadata[IdempotencyMetadataKey] = key
+	email.Metadata = metadata
+
+	return sender.send(ctx, key, func() (EmailResponse, error) {
+		return sender.Sender.SendTemplatedEmail(ctx, email)
+	})
+}
+
+// send runs fn once per key, concurrent calls with the same key wait for each other
+func (sender *IdempotentSender) send(ctx context.Context, key string, fn func() (EmailResponse, error)) (EmailResponse, error) {
+	if key == "" {
+		return EmailResponse{}, errors.New("postmark: empty idempotency key")
+	}
+
+	sender.locks.lock(key)
+	defer sender.locks.unlock(key)
+
+	if res, ok, err := sender.Store.Get(ctx, key); err != nil || ok {
+		return res, err
+	}
+
+	res, err := fn()
+	if err != nil || res.ErrorCode != 0 {
+		return res, err
+	}
+	return res, sender.Store.Put(ctx, key, res)
+}
+
+// Reconcile searches the outbound messages for one sent with key. If found, the
+// response is stored so later sends with key do not send again, and true is returned.
+// Postmark indexes messages asynchronously, so a very recent send may not be found yet.
+func (sender *IdempotentSender) Reconcile(ctx context.Context, client *Client, key string) (EmailResponse, bool, error) {
+	if res, ok, err := sender.Store.Get(ctx, key); err != nil || ok {
+		return res, ok, err
+	}
+
+	messages, _, err := client.GetOutboundMessages(ctx, 1, 0, map[string]interface{}{
+		"metadata_" + IdempotencyMetadataKey: key,
+	})
+	if err != nil || len(messages) == 0 {
+		return EmailResponse{}, false, err
+	}
+
+	msg := messages[0]
+	res := EmailResponse{
+		MessageID:   msg.MessageID,
+		SubmittedAt: msg.ReceivedAt,
+		Message:     "OK",
+	}
+	if len(msg.Recipients) > 0 {
+		res.To = msg.Recipients[0]
+	}
+	return res, true, sender.Store.Put(ctx, key, res)
+}
+
+// keyedLocks is a set of mutexes by key, entries are removed once unused
+type keyedLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+func (l *keyedLocks) lock(key string) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*keyedLock{}
+	}
+	kl, ok := l.locks[key]
+	if !ok {
+		kl = &keyedLock{}
+		l.locks[key] = kl
+	}
+	kl.refs++
+	l.mu.Unlock()
+
+	kl.Lock()
+}
+
+func (l *keyedLocks) unlock(key string) {
+	l.mu.Lock()
+	kl := l.locks[key]
+	kl.refs--
+	if kl.refs == 0 {
+		delete(l.locks, key)
+	}
+	l.mu.Unlock()
+
+	kl.Unlock()
+}
@@ -0,0 +1,311 @@
+package postmark
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const (
+	// maxHeaderLineLength is the line length recommended by RFC 5322 section 2.1.1
+	maxHeaderLineLength = 78
+	// maxBase64LineLength is the line length required by RFC 2045 section 6.8
+	maxBase64LineLength = 76
+	crlf                = "\r\n"
+)
+
+// mimeNow returns the timestamp used for the Date header
+var mimeNow = time.Now
+
+// addressHeaders holds the headers which contain address lists
+var addressHeaders = map[string]bool{
+	"From":     true,
+	"To":       true,
+	"Cc":       true,
+	"Reply-To": true,
+	"Sender":   true,
+}
+
+// WriteMIME writes the email as an RFC 5322 message to w.
+//
+// The body is built as multipart/mixed (when there are regular attachments)
+// wrapping multipart/related (when there are attachments with a ContentID)
+// wrapping multipart/alternative (when both TextBody and HTMLBody are set).
+// Text parts use quoted-printable and attachments use base64 encoding.
+// Bcc recipients are not written, as the header must not be visible to other recipients.
+func (email Email) WriteMIME(w io.Writer) error {
+	body, err := email.mimeBody()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, h := range email.mimeHeaders() {
+		if _, err = io.WriteString(bw, foldHeader(h.Name, h.Value)); err != nil {
+			return err
+		}
+	}
+	if err = body.write(bw, true); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// mimeHeaders returns the top level message headers, without the entity headers
+func (email Email) mimeHeaders() []Header {
+	var headers []Header
+	add := func(name, value string) {
+		if value == "" {
+			return
+		}
+		headers = append(headers, Header{Name: name, Value: encodeHeaderValue(name, value)})
+	}
+
+	custom := map[string]bool{}
+	for _, h := range email.Headers {
+		custom[textproto.CanonicalMIMEHeaderKey(h.Name)] = true
+	}
+
+	add("From", email.From)
+	add("To", email.To)
+	add("Cc", email.Cc)
+	add("Reply-To", email.ReplyTo)
+	add("Subject", email.Subject)
+	if !custom["Date"] {
+		add("Date", mimeNow().Format(time.RFC1123Z))
+	}
+	if !custom["Message-Id"] {
+		add("Message-ID", generateMessageID(email.From))
+	}
+	for _, h := range email.Headers {
+		add(h.Name, h.Value)
+	}
+	headers = append(headers, Header{Name: "MIME-Version", Value: "1.0"})
+	return headers
+}
+
+// mimePart is a node of the MIME tree, either a leaf with content or a multipart container
+type mimePart struct {
+	header   textproto.MIMEHeader
+	content  []byte
+	encoding string
+	boundary string
+	children []*mimePart
+}
+
+// mimeBody builds the MIME tree for the email body and attachments
+func (email Email) mimeBody() (*mimePart, error) {
+	var alternatives []*mimePart
+	if email.TextBody != "" {
+		alternatives = append(alternatives, textPart("text/plain", email.TextBody))
+	}
+	if email.HTMLBody != "" {
+		alternatives = append(alternatives, textPart("text/html", email.HTMLBody))
+	}
+	if len(alternatives) == 0 {
+		alternatives = append(alternatives, textPart("text/plain", ""))
+	}
+	body := multipartOf("alternative", alternatives)
+
+	var inline, attached []*mimePart
+	for _, a := range email.Attachments {
+		part, err := attachmentPart(a)
+		if err != nil {
+			return nil, err
+		}
+		if a.ContentID != "" {
+			inline = append(inline, part)
+		} else {
+			attached = append(attached, part)
+		}
+	}
+	if len(inline) > 0 {
+		body = multipartOf("related", append([]*mimePart{body}, inline...))
+	}
+	if len(attached) > 0 {
+		body = multipartOf("mixed", append([]*mimePart{body}, attached...))
+	}
+	return body, nil
+}
+
+// multipartOf wraps parts in a multipart container, or returns the part itself if there is only one
+func multipartOf(subtype string, parts []*mimePart) *mimePart {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	boundary := randomBoundary()
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": boundary}))
+	return &mimePart{header: header, boundary: boundary, children: parts}
+}
+
+func textPart(contentType, text string) *mimePart {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType(contentType, map[string]string{"charset": "utf-8"}))
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	return &mimePart{header: header, content: []byte(text), encoding: "quoted-printable"}
+}
+
+func attachmentPart(a Attachment) (*mimePart, error) {
+	content, err := base64.StdEncoding.DecodeString(a.Content)
+	if err != nil {
+		return nil, fmt.Errorf("attachment %q: %w", a.Name, err)
+	}
+
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	disposition := "attachment"
+	if a.ContentID != "" {
+		disposition = "inline"
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType(contentType, map[string]string{"name": a.Name}))
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Name}))
+	header.Set("Content-Transfer-Encoding", "base64")
+	if a.ContentID != "" {
+		header.Set("Content-ID", "<"+strings.TrimPrefix(strings.Trim(a.ContentID, "<>"), "cid:")+">")
+	}
+	return &mimePart{header: header, content: content, encoding: "base64"}, nil
+}
+
+// write writes the part to w. Headers are written when top is set, otherwise
+// they are written by the enclosing multipart writer.
+func (p *mimePart) write(w io.Writer, top bool) error {
+	if top {
+		for _, name := range []string{"Content-Type", "Content-Transfer-Encoding", "Content-Disposition", "Content-ID"} {
+			if v := p.header.Get(name); v != "" {
+				if _, err := io.WriteString(w, foldHeader(name, v)); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := io.WriteString(w, crlf); err != nil {
+			return err
+		}
+	}
+
+	if p.boundary == "" {
+		return p.writeContent(w)
+	}
+
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(p.boundary); err != nil {
+		return err
+	}
+	for _, child := range p.children {
+		pw, err := mw.CreatePart(child.header)
+		if err != nil {
+			return err
+		}
+		if err = child.write(pw, false); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+func (p *mimePart) writeContent(w io.Writer) error {
+	switch p.encoding {
+	case "quoted-printable":
+		qw := quotedprintable.NewWriter(w)
+		if _, err := qw.Write(p.content); err != nil {
+			return err
+		}
+		return qw.Close()
+	case "base64":
+		encoded := base64.StdEncoding.EncodeToString(p.content)
+		for len(encoded) > maxBase64LineLength {
+			if _, err := io.WriteString(w, encoded[:maxBase64LineLength]+crlf); err != nil {
+				return err
+			}
+			encoded = encoded[maxBase64LineLength:]
+		}
+		_, err := io.WriteString(w, encoded+crlf)
+		return err
+	default:
+		_, err := w.Write(p.content)
+		return err
+	}
+}
+
+// encodeHeaderValue applies RFC 2047 encoding to non-ASCII header values.
+// Address lists are parsed so that only display names are encoded.
+func encodeHeaderValue(name, value string) string {
+	value = strings.NewReplacer("\r", "", "\n", " ").Replace(value)
+
+	if addressHeaders[textproto.CanonicalMIMEHeaderKey(name)] {
+		if list, err := mail.ParseAddressList(value); err == nil {
+			formatted := make([]string, len(list))
+			for i, addr := range list {
+				formatted[i] = addr.String()
+			}
+			return strings.Join(formatted, ", ")
+		}
+	}
+	if isASCII(value) {
+		return value
+	}
+	return mime.QEncoding.Encode("utf-8", value)
+}
+
+// foldHeader formats a header line, folding it on whitespace so lines do not exceed
+// maxHeaderLineLength where possible
+func foldHeader(name, value string) string {
+	var sb strings.Builder
+	line := name + ":"
+	for _, word := range strings.Fields(value) {
+		if len(line)+1+len(word) > maxHeaderLineLength && strings.TrimSpace(line) != name+":" {
+			sb.WriteString(line + crlf)
+			line = ""
+		}
+		line += " " + word
+	}
+	sb.WriteString(line + crlf)
+	return sb.String()
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func randomBoundary() string {
+	return randomHex(24)
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// generateMessageID builds a Message-ID using the domain of the from address
+func generateMessageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if i := strings.LastIndex(addr.Address, "@"); i >= 0 {
+			domain = addr.Address[i+1:]
+		}
+	}
+	return fmt.Sprintf("<%s@%s>", randomHex(16), domain)
+}
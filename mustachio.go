@@ -0,0 +1,483 @@
+package postmark
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrLayoutNotFound is returned when rendering a template whose layout is not known
+var ErrLayoutNotFound = errors.New("postmark: layout not found")
+
+// TemplateSyntaxError is a Mustachio syntax error at a position of a template part
+type TemplateSyntaxError struct {
+	// Line: 1-based line of the error
+	Line int
+	// CharacterPosition: 1-based column of the error
+	CharacterPosition int
+	// Message describes the error
+	Message string
+}
+
+// Error returns the error message with its position
+func (err TemplateSyntaxError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", err.Line, err.CharacterPosition, err.Message)
+}
+
+// TemplateRenderer renders templates locally using Postmark's Mustachio syntax:
+// {{var}} (HTML escaped in the HTML body), {{{raw}}} and {{& raw}}, dotted paths,
+// ../ parent paths, {{#each list}}, {{#section}}, {{^inverted}} and layouts via
+// {{{@content}}}. It allows previewing and unit testing templates without calling
+// ValidateTemplate.
+type TemplateRenderer struct {
+	// Layouts by alias, used for templates with a LayoutTemplate
+	Layouts map[string]Template
+	// InlineCSS inlines <style> blocks into the rendered HTML, as Postmark does when sending
+	InlineCSS bool
+}
+
+// RenderedTemplate is the output of TemplateRenderer.Render
+type RenderedTemplate struct {
+	// Subject: rendered subject
+	Subject string
+	// HTMLBody: rendered HTML body, wrapped in the layout HTML body if any
+	HTMLBody string
+	// TextBody: rendered text body, wrapped in the layout text body if any
+	TextBody string
+	// MissingKeys: dotted paths used by the template but absent from the model
+	MissingKeys []string
+	// SuggestedTemplateModel: a model with every path used by the template, in the
+	// same shape as ValidateTemplateResponse.SuggestedTemplateModel
+	SuggestedTemplateModel map[string]interface{}
+}
+
+// RenderTemplate renders template with model, without layouts
+func RenderTemplate(template Template, model map[string]interface{}) (RenderedTemplate, error) {
+	return (&TemplateRenderer{}).Render(template, model)
+}
+
+// Render renders the subject and bodies of template with model
+func (r *TemplateRenderer) Render(template Template, model map[string]interface{}) (RenderedTemplate, error) {
+	res := RenderedTemplate{SuggestedTemplateModel: map[string]interface{}{}}
+	missing := map[string]bool{}
+
+	var layout *Template
+	if template.LayoutTemplate != "" {
+		l, ok := r.Layouts[template.LayoutTemplate]
+		if !ok {
+			return res, fmt.Errorf("%w: %q", ErrLayoutNotFound, template.LayoutTemplate)
+		}
+		layout = &l
+	}
+
+	render := func(part, source string, escape bool, content *string) (string, error) {
+		nodes, err := parseMustachio(source)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", part, err)
+		}
+		suggestMustachio(nodes, res.SuggestedTemplateModel, nil)
+		st := &mustachioState{escape: escape, content: content, missing: missing}
+		var sb strings.Builder
+		st.render(&sb, nodes, []mustachioScope{{value: model}})
+		return sb.String(), nil
+	}
+
+	var err error
+	if res.Subject, err = render("Subject", template.Subject, false, nil); err != nil {
+		return res, err
+	}
+	if res.HTMLBody, err = render("HtmlBody", template.HTMLBody, true, nil); err != nil {
+		return res, err
+	}
+	if res.TextBody, err = render("TextBody", template.TextBody, false, nil); err != nil {
+		return res, err
+	}
+
+	// A layout part which is empty leaves the matching template part unwrapped
+	if layout != nil && layout.HTMLBody != "" {
+		if res.HTMLBody, err = render("Layout HtmlBody", layout.HTMLBody, true, &res.HTMLBody); err != nil {
+			return res, err
+		}
+	}
+	if layout != nil && layout.TextBody != "" {
+		if res.TextBody, err = render("Layout TextBody", layout.TextBody, false, &res.TextBody); err != nil {
+			return res, err
+		}
+	}
+
+	if r.InlineCSS && res.HTMLBody != "" {
+		preflight, err := PreflightHTML(res.HTMLBody, PreflightOptions{})
+		if err != nil {
+			return res, err
+		}
+		res.HTMLBody = preflight.HTML
+	}
+
+	for key := range missing {
+		res.MissingKeys = append(res.MissingKeys, key)
+	}
+	sort.Strings(res.MissingKeys)
+	return res, nil
+}
+
+type mustachioKind int
+
+const (
+	mustachioText mustachioKind = iota
+	mustachioVar
+	mustachioRaw
+	mustachioEach
+	mustachioSection
+	mustachioInverted
+)
+
+// mustachioNode is a node of a parsed template
+type mustachioNode struct {
+	kind     mustachioKind
+	text     string
+	path     string
+	children []*mustachioNode
+}
+
+// mustachioOpenTag is a section waiting for its closing tag
+type mustachioOpenTag struct {
+	name      string
+	line, col int
+}
+
+// parseMustachio parses a template into a tree of nodes
+func parseMustachio(source string) ([]*mustachioNode, error) {
+	root := &mustachioNode{}
+	stack := []*mustachioNode{root}
+	var open []mustachioOpenTag
+
+	pos := 0
+	for pos < len(source) {
+		start := strings.Index(source[pos:], "{{")
+		if start < 0 {
+			break
+		}
+		start += pos
+		top := stack[len(stack)-1]
+		if start > pos {
+			top.children = append(top.children, &mustachioNode{kind: mustachioText, text: source[pos:start]})
+		}
+
+		line, col := mustachioPosition(source, start)
+		closing := "}}"
+		tagStart := start + 2
+		if strings.HasPrefix(source[start:], "{{{") {
+			closing = "}}}"
+			tagStart = start + 3
+		}
+		end := strings.Index(source[tagStart:], closing)
+		if end < 0 {
+			return nil, TemplateSyntaxError{Line: line, CharacterPosition: col, Message: "unclosed tag, expected " + closing}
+		}
+		tag := strings.TrimSpace(source[tagStart : tagStart+end])
+		pos = tagStart + end + len(closing)
+
+		if tag == "" {
+			return nil, TemplateSyntaxError{Line: line, CharacterPosition: col, Message: "empty tag"}
+		}
+		if closing == "}}}" {
+			top.children = append(top.children, &mustachioNode{kind: mustachioRaw, path: tag})
+			continue
+		}
+
+		switch tag[0] {
+		case '!':
+			// comment
+		case '&':
+			top.children = append(top.children, &mustachioNode{kind: mustachioRaw, path: strings.TrimSpace(tag[1:])})
+		case '#', '^':
+			name := strings.TrimSpace(tag[1:])
+			node := &mustachioNode{kind: mustachioSection, path: name}
+			if tag[0] == '^' {
+				node.kind = mustachioInverted
+			} else if fields := strings.Fields(name); len(fields) == 2 && fields[0] == "each" {
+				node.kind = mustachioEach
+				node.path = fields[1]
+				name = "each"
+			}
+			if node.path == "" {
+				return nil, TemplateSyntaxError{Line: line, CharacterPosition: col, Message: "missing section name"}
+			}
+			top.children = append(top.children, node)
+			stack = append(stack, node)
+			open = append(open, mustachioOpenTag{name: name, line: line, col: col})
+		case '/':
+			name := strings.TrimSpace(tag[1:])
+			if len(open) == 0 {
+				return nil, TemplateSyntaxError{Line: line, CharacterPosition: col, Message: fmt.Sprintf("unexpected closing tag {{/%s}}", name)}
+			}
+			if expected := open[len(open)-1].name; expected != name {
+				return nil, TemplateSyntaxError{Line: line, CharacterPosition: col, Message: fmt.Sprintf("closing tag {{/%s}} does not match {{#%s}}", name, expected)}
+			}
+			stack = stack[:len(stack)-1]
+			open = open[:len(open)-1]
+		default:
+			top.children = append(top.children, &mustachioNode{kind: mustachioVar, path: tag})
+		}
+	}
+
+	if pos < len(source) {
+		top := stack[len(stack)-1]
+		top.children = append(top.children, &mustachioNode{kind: mustachioText, text: source[pos:]})
+	}
+	if len(open) > 0 {
+		last := open[len(open)-1]
+		return nil, TemplateSyntaxError{Line: last.line, CharacterPosition: last.col, Message: fmt.Sprintf("section {{#%s}} is not closed", last.name)}
+	}
+	return root.children, nil
+}
+
+// mustachioPosition returns the 1-based line and column of offset in source
+func mustachioPosition(source string, offset int) (int, int) {
+	before := source[:offset]
+	line := strings.Count(before, "\n") + 1
+	col := offset - strings.LastIndex(before, "\n")
+	return line, col
+}
+
+// mustachioScope is a value in the context stack, with its dotted path for reporting
+type mustachioScope struct {
+	value interface{}
+	path  string
+}
+
+type mustachioState struct {
+	escape  bool
+	content *string
+	missing map[string]bool
+}
+
+func (st *mustachioState) render(sb *strings.Builder, nodes []*mustachioNode, scopes []mustachioScope) {
+	for _, n := range nodes {
+		switch n.kind {
+		case mustachioText:
+			sb.WriteString(n.text)
+		case mustachioVar, mustachioRaw:
+			if n.path == "@content" {
+				if st.content != nil {
+					sb.WriteString(*st.content)
+				}
+				continue
+			}
+			value, ok := st.lookup(n.path, scopes)
+			if !ok || value == nil {
+				continue
+			}
+			text := formatMustachioValue(value)
+			if n.kind == mustachioVar && st.escape {
+				text = html.EscapeString(text)
+			}
+			sb.WriteString(text)
+		case mustachioEach:
+			value, ok := st.lookup(n.path, scopes)
+			if !ok {
+				continue
+			}
+			rv := reflect.ValueOf(value)
+			if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+				continue
+			}
+			path := joinMustachioPath(scopes[len(scopes)-1].path, n.path)
+			for i := 0; i < rv.Len(); i++ {
+				item := mustachioScope{value: rv.Index(i).Interface(), path: path}
+				st.render(sb, n.children, append(scopes, item))
+			}
+		case mustachioSection:
+			value, ok := st.lookup(n.path, scopes)
+			if !ok || !mustachioTruthy(value) {
+				continue
+			}
+			rv := reflect.ValueOf(value)
+			if rv.Kind() == reflect.Map || rv.Kind() == reflect.Struct || (rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Struct) {
+				scope := mustachioScope{value: value, path: joinMustachioPath(scopes[len(scopes)-1].path, n.path)}
+				st.render(sb, n.children, append(scopes, scope))
+			} else {
+				st.render(sb, n.children, scopes)
+			}
+		case mustachioInverted:
+			value, ok := st.lookup(n.path, scopes)
+			if !ok || !mustachioTruthy(value) {
+				st.render(sb, n.children, scopes)
+			}
+		}
+	}
+}
+
+// lookup resolves a dotted path, possibly starting with ../ segments, against the scopes
+func (st *mustachioState) lookup(path string, scopes []mustachioScope) (interface{}, bool) {
+	for strings.HasPrefix(path, "../") {
+		path = path[3:]
+		if len(scopes) > 1 {
+			scopes = scopes[:len(scopes)-1]
+		}
+	}
+	scope := scopes[len(scopes)-1]
+	if path == "." || path == "this" {
+		return scope.value, true
+	}
+
+	value := scope.value
+	for _, segment := range strings.Split(path, ".") {
+		next, ok := mustachioField(value, segment)
+		if !ok {
+			st.missing[joinMustachioPath(scope.path, path)] = true
+			return nil, false
+		}
+		value = next
+	}
+	return value, true
+}
+
+// mustachioField returns the value of key in a map or struct
+func mustachioField(value interface{}, key string) (interface{}, bool) {
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		v := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+		if !v.IsValid() {
+			return nil, false
+		}
+		return v.Interface(), true
+	case reflect.Struct:
+		t := rv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := f.Name
+			if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag != "" && tag != "-" {
+				name = tag
+			}
+			if name == key {
+				return rv.Field(i).Interface(), true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < rv.Len() {
+			return rv.Index(i).Interface(), true
+		}
+	}
+	return nil, false
+}
+
+func mustachioTruthy(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() > 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint() != 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() != 0
+	case reflect.Ptr, reflect.Interface:
+		return !rv.IsNil()
+	}
+	return true
+}
+
+func formatMustachioValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func joinMustachioPath(prefix, path string) string {
+	if prefix == "" {
+		return path
+	}
+	return prefix + "." + path
+}
+
+// suggestMustachio adds every path used by nodes to model, the way Postmark builds
+// SuggestedTemplateModel: leaves are "<name>_Value" and each blocks become a list
+// holding one item
+func suggestMustachio(nodes []*mustachioNode, model map[string]interface{}, parents []map[string]interface{}) {
+	for _, n := range nodes {
+		if n.kind == mustachioText || n.path == "@content" {
+			continue
+		}
+
+		ctx, stack, path := model, parents, n.path
+		for strings.HasPrefix(path, "../") {
+			path = path[3:]
+			if len(stack) > 0 {
+				ctx, stack = stack[len(stack)-1], stack[:len(stack)-1]
+			}
+		}
+		if path == "." || path == "this" {
+			suggestMustachio(n.children, ctx, stack)
+			continue
+		}
+
+		scope := ctx
+		segments := strings.Split(path, ".")
+		for _, segment := range segments[:len(segments)-1] {
+			scope = suggestedChild(scope, segment)
+		}
+		last := segments[len(segments)-1]
+		childParents := append(append([]map[string]interface{}{}, stack...), ctx)
+
+		switch n.kind {
+		case mustachioEach:
+			item := map[string]interface{}{}
+			if list, ok := scope[last].([]interface{}); ok && len(list) > 0 {
+				if m, ok := list[0].(map[string]interface{}); ok {
+					item = m
+				}
+			}
+			scope[last] = []interface{}{item}
+			suggestMustachio(n.children, item, childParents)
+		case mustachioSection:
+			suggestMustachio(n.children, suggestedChild(scope, last), childParents)
+		default:
+			if _, ok := scope[last]; !ok {
+				scope[last] = last + "_Value"
+			}
+			suggestMustachio(n.children, model, parents)
+		}
+	}
+}
+
+// suggestedChild returns the nested map at key, replacing leaf suggestions
+func suggestedChild(scope map[string]interface{}, key string) map[string]interface{} {
+	if child, ok := scope[key].(map[string]interface{}); ok {
+		return child
+	}
+	child := map[string]interface{}{}
+	scope[key] = child
+	return child
+}
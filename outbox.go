@@ -0,0 +1,438 @@
+package postmark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OutboxStatus is the delivery state of an OutboxMessage
+type OutboxStatus string
+
+const (
+	// OutboxPending means the message is waiting to be sent, possibly after a failed attempt
+	OutboxPending OutboxStatus = "pending"
+	// OutboxClaimed means a dispatcher is currently sending the message
+	OutboxClaimed OutboxStatus = "claimed"
+	// OutboxSent means Postmark accepted the message, see MessageID
+	OutboxSent OutboxStatus = "sent"
+	// OutboxDead means the message failed permanently or ran out of attempts, see Error
+	OutboxDead OutboxStatus = "dead"
+	// OutboxCanceled means the message was canceled before it was sent
+	OutboxCanceled OutboxStatus = "canceled"
+)
+
+// ErrOutboxMessageNotFound is returned by an OutboxStore for unknown message IDs
+var ErrOutboxMessageNotFound = errors.New("postmark: outbox message not found")
+
+// ErrOutboxMessageNotPending is returned when canceling a message which is being sent or is already done
+var ErrOutboxMessageNotPending = errors.New("postmark: outbox message is not pending")
+
+// OutboxMessage is an email persisted for guaranteed delivery.
+// Exactly one of Email and TemplatedEmail is set.
+type OutboxMessage struct {
+	// ID of the outbox message, assigned on Enqueue if empty
+	ID string
+	// Email to send with SendEmail
+	Email *Email
+	// TemplatedEmail to send with SendTemplatedEmail
+	TemplatedEmail *TemplatedEmail
+	// Status of the message
+	Status OutboxStatus
+	// Attempts is the number of sends attempted so far
+	Attempts int
+	// NextAttemptAt is the earliest time the message may be claimed
+	NextAttemptAt time.Time
+	// ClaimedUntil is when the claim of a dispatcher expires, so crashed dispatchers
+	// do not hold messages forever
+	ClaimedUntil time.Time
+	// MessageID returned by Postmark once sent
+	MessageID string
+	// Error of the last failed attempt
+	Error *APIError
+	// CreatedAt: Timestamp
+	CreatedAt time.Time
+	// UpdatedAt: Timestamp
+	UpdatedAt time.Time
+}
+
+// NewOutboxEmail builds a pending OutboxMessage for email
+func NewOutboxEmail(email Email) OutboxMessage {
+	return OutboxMessage{Email: &email, Status: OutboxPending}
+}
+
+// NewOutboxTemplatedEmail builds a pending OutboxMessage for email
+func NewOutboxTemplatedEmail(email TemplatedEmail) OutboxMessage {
+	return OutboxMessage{TemplatedEmail: &email, Status: OutboxPending}
+}
+
+// OutboxStore persists outbox messages. Implementations must make Claim atomic,
+// so a message is only handed to one dispatcher at a time.
+type OutboxStore interface {
+	// Enqueue saves a new message created at the given time and returns it with
+	// its ID set
+	Enqueue(ctx context.Context, msg OutboxMessage, at time.Time) (OutboxMessage, error)
+	// Claim marks up to limit pending messages due at now, or claimed messages
+	// whose claim expired, as claimed until now+lease and returns them
+	Claim(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]OutboxMessage, error)
+	// MarkSent records the MessageID returned by Postmark
+	MarkSent(ctx context.Context, id string, messageID string, at time.Time) error
+	// MarkRetry returns a message to pending, to be retried at next
+	MarkRetry(ctx context.Context, id string, next time.Time, apiErr *APIError, at time.Time) error
+	// MarkDead moves a message to the dead-letter state
+	MarkDead(ctx context.Context, id string, apiErr *APIError, at time.Time) error
+	// Cancel moves a pending message to the canceled state, it fails with
+	// ErrOutboxMessageNotPending for messages which are claimed or done
+	Cancel(ctx context.Context, id string, at time.Time) error
+	// Get returns a message by ID
+	Get(ctx context.Context, id string) (OutboxMessage, error)
+	// List returns all messages with the given status, oldest first
+	List(ctx context.Context, status OutboxStatus) ([]OutboxMessage, error)
+}
+
+// MemoryOutboxStore is an OutboxStore kept in memory. It does not survive restarts
+// and is intended for tests and development.
+type MemoryOutboxStore struct {
+	mu       sync.Mutex
+	messages map[string]*OutboxMessage
+}
+
+var _ OutboxStore = (*MemoryOutboxStore)(nil)
+
+// NewMemoryOutboxStore builds an empty MemoryOutboxStore
+func NewMemoryOutboxStore() *MemoryOutboxStore {
+	return &MemoryOutboxStore{messages: map[string]*OutboxMessage{}}
+}
+
+// Enqueue saves a new message
+func (store *MemoryOutboxStore) Enqueue(_ context.Context, msg OutboxMessage, at time.Time) (OutboxMessage, error) {
+	msg = prepareOutboxMessage(msg, at)
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.messages[msg.ID]; ok {
+		return msg, fmt.Errorf("postmark: outbox message %s already exists", msg.ID)
+	}
+	store.messages[msg.ID] = &msg
+	return msg, nil
+}
+
+// Claim claims due messages
+func (store *MemoryOutboxStore) Claim(_ context.Context, now time.Time, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var due []*OutboxMessage
+	for _, msg := range store.messages {
+		if outboxDue(*msg, now) {
+			due = append(due, msg)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].CreatedAt.Before(due[j].CreatedAt)
+	})
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]OutboxMessage, 0, len(due))
+	for _, msg := range due {
+		msg.Status = OutboxClaimed
+		msg.ClaimedUntil = now.Add(lease)
+		msg.UpdatedAt = now
+		claimed = append(claimed, *msg)
+	}
+	return claimed, nil
+}
+
+// MarkSent records the MessageID returned by Postmark
+func (store *MemoryOutboxStore) MarkSent(_ context.Context, id string, messageID string, at time.Time) error {
+	return store.update(id, func(msg *OutboxMessage) {
+		msg.Status = OutboxSent
+		msg.Attempts++
+		msg.MessageID = messageID
+		msg.Error = nil
+		msg.UpdatedAt = at
+	})
+}
+
+// MarkRetry returns a message to pending
+func (store *MemoryOutboxStore) MarkRetry(_ context.Context, id string, next time.Time, apiErr *APIError, at time.Time) error {
+	return store.update(id, func(msg *OutboxMessage) {
+		msg.Status = OutboxPending
+		msg.Attempts++
+		msg.NextAttemptAt = next
+		msg.Error = apiErr
+		msg.UpdatedAt = at
+	})
+}
+
+// MarkDead moves a message to the dead-letter state
+func (store *MemoryOutboxStore) MarkDead(_ context.Context, id string, apiErr *APIError, at time.Time) error {
+	return store.update(id, func(msg *OutboxMessage) {
+		msg.Status = OutboxDead
+		msg.Attempts++
+		msg.Error = apiErr
+		msg.UpdatedAt = at
+	})
+}
+
+// Cancel moves a pending message to the canceled state
+func (store *MemoryOutboxStore) Cancel(_ context.Context, id string, at time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	msg, ok := store.messages[id]
+	if !ok {
+		return ErrOutboxMessageNotFound
+	}
+	if msg.Status != OutboxPending {
+		return ErrOutboxMessageNotPending
+	}
+	msg.Status = OutboxCanceled
+	msg.UpdatedAt = at
+	return nil
+}
+
+// Get returns a message by ID
+func (store *MemoryOutboxStore) Get(_ context.Context, id string) (OutboxMessage, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	msg, ok := store.messages[id]
+	if !ok {
+		return OutboxMessage{}, ErrOutboxMessageNotFound
+	}
+	return *msg, nil
+}
+
+// List returns all messages with the given status
+func (store *MemoryOutboxStore) List(_ context.Context, status OutboxStatus) ([]OutboxMessage, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var res []OutboxMessage
+	for _, msg := range store.messages {
+		if msg.Status == status {
+			res = append(res, *msg)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+	return res, nil
+}
+
+func (store *MemoryOutboxStore) update(id string, fn func(msg *OutboxMessage)) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	msg, ok := store.messages[id]
+	if !ok {
+		return ErrOutboxMessageNotFound
+	}
+	fn(msg)
+	return nil
+}
+
+// prepareOutboxMessage fills in the defaults of a message about to be enqueued
+func prepareOutboxMessage(msg OutboxMessage, now time.Time) OutboxMessage {
+	if msg.ID == "" {
+		msg.ID = randomHex(16)
+	}
+	if msg.Status == "" {
+		msg.Status = OutboxPending
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = now
+	}
+	msg.UpdatedAt = now
+	return msg
+}
+
+// outboxDue reports whether msg can be claimed at now
+func outboxDue(msg OutboxMessage, now time.Time) bool {
+	switch msg.Status {
+	case OutboxPending:
+		return !msg.NextAttemptAt.After(now)
+	case OutboxClaimed:
+		return !msg.ClaimedUntil.After(now)
+	default:
+		return false
+	}
+}
+
+// OutboxDispatcher claims messages from an OutboxStore, sends them and records the outcome.
+// Messages failing with a Postmark APIError are dead-lettered immediately, other errors
+// (network failures, timeouts) are retried with backoff until MaxAttempts is reached.
+type OutboxDispatcher struct {
+	// Store holds the messages to dispatch
+	Store OutboxStore
+	// Sender sends the messages, usually a *Client
+	Sender Sender
+	// BatchSize is the maximum number of messages claimed at once, 10 by default
+	BatchSize int
+	// Lease is how long a claim lasts before another dispatcher may take over, 1 minute by default
+	Lease time.Duration
+	// MaxAttempts before a message is dead-lettered, 10 by default
+	MaxAttempts int
+	// PollInterval is how often Run looks for due messages, 5 seconds by default
+	PollInterval time.Duration
+	// Backoff returns the delay before the given attempt (starting at 1) is retried.
+	// Defaults to exponential backoff from 1 second, capped at 1 hour.
+	Backoff func(attempt int) time.Duration
+	// IsPermanent reports whether err should not be retried. By default, errors
+	// carrying a Postmark error code are permanent.
+	IsPermanent func(err error) bool
+	// Now returns the current time, time.Now by default
+	Now func() time.Time
+	// OnError is called with errors from the store, which do not stop Run
+	OnError func(error)
+}
+
+// NewOutboxDispatcher builds an OutboxDispatcher with default settings
+func NewOutboxDispatcher(store OutboxStore, sender Sender) *OutboxDispatcher {
+	return &OutboxDispatcher{
+		Store:        store,
+		Sender:       sender,
+		BatchSize:    10,
+		Lease:        time.Minute,
+		MaxAttempts:  10,
+		PollInterval: 5 * time.Second,
+	}
+}
+
+// Run dispatches due messages every PollInterval until ctx is done
+func (d *OutboxDispatcher) Run(ctx context.Context) error {
+	interval := d.PollInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := d.DispatchOnce(ctx)
+			if err != nil {
+				d.onError(err)
+			}
+			if err != nil || n < d.batchSize() {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOnce claims one batch of due messages and sends them. It returns the
+// number of messages claimed.
+func (d *OutboxDispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	lease := d.Lease
+	if lease <= 0 {
+		lease = time.Minute
+	}
+
+	messages, err := d.Store.Claim(ctx, d.now(), d.batchSize(), lease)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	for _, msg := range messages {
+		if err = d.dispatch(ctx, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(messages), errors.Join(errs...)
+}
+
+// dispatch sends a single message and records the outcome in the store
+func (d *OutboxDispatcher) dispatch(ctx context.Context, msg OutboxMessage) error {
+	var res EmailResponse
+	var err error
+	switch {
+	case msg.Email != nil:
+		res, err = d.Sender.SendEmail(ctx, *msg.Email)
+	case msg.TemplatedEmail != nil:
+		res, err = d.Sender.SendTemplatedEmail(ctx, *msg.TemplatedEmail)
+	default:
+		return d.Store.MarkDead(ctx, msg.ID, &APIError{Message: "outbox message has no email"}, d.now())
+	}
+
+	if err == nil && res.ErrorCode == 0 {
+		return d.Store.MarkSent(ctx, msg.ID, res.MessageID, d.now())
+	}
+
+	apiErr := outboxAPIError(res, err)
+	attempt := msg.Attempts + 1
+	maxAttempts := d.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 10
+	}
+	if d.isPermanent(res, err) || attempt >= maxAttempts {
+		return d.Store.MarkDead(ctx, msg.ID, apiErr, d.now())
+	}
+	now := d.now()
+	return d.Store.MarkRetry(ctx, msg.ID, now.Add(d.backoff(attempt)), apiErr, now)
+}
+
+func (d *OutboxDispatcher) isPermanent(res EmailResponse, err error) bool {
+	// Postmark accepted the request but rejected the message. Client.SendEmail
+	// also returns a plain error in that case, which must not hide the code.
+	if res.ErrorCode != 0 {
+		return true
+	}
+	if err == nil {
+		return false
+	}
+	if d.IsPermanent != nil {
+		return d.IsPermanent(err)
+	}
+	var apiErr APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode != 0
+}
+
+func (d *OutboxDispatcher) backoff(attempt int) time.Duration {
+	if d.Backoff != nil {
+		return d.Backoff(attempt)
+	}
+	delay := time.Second << min(attempt-1, 12)
+	return min(delay, time.Hour)
+}
+
+func (d *OutboxDispatcher) batchSize() int {
+	if d.BatchSize <= 0 {
+		return 10
+	}
+	return d.BatchSize
+}
+
+func (d *OutboxDispatcher) now() time.Time {
+	if d.Now != nil {
+		return d.Now()
+	}
+	return time.Now()
+}
+
+func (d *OutboxDispatcher) onError(err error) {
+	if d.OnError != nil {
+		d.OnError(err)
+	}
+}
+
+// outboxAPIError converts the outcome of a failed send into an APIError for storage
+func outboxAPIError(res EmailResponse, err error) *APIError {
+	var apiErr APIError
+	if errors.As(err, &apiErr) {
+		return &apiErr
+	}
+	if res.ErrorCode != 0 {
+		return &APIError{ErrorCode: res.ErrorCode, Message: res.Message}
+	}
+	return &APIError{Message: err.Error()}
+}
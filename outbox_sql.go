@@ -0,0 +1,338 @@
+package postmark
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const defaultOutboxTable = "postmark_outbox"
+
+// SQLOutboxStore is an OutboxStore backed by database/sql. Any driver can be
+// used, the schema only relies on portable column types. Call CreateTable once
+// to set up the table.
+type SQLOutboxStore struct {
+	// DB is the database holding the outbox table
+	DB *sql.DB
+	// Table name, postmark_outbox by default
+	Table string
+	// Placeholder is the bind parameter style of the driver
+	Placeholder SQLPlaceholder
+}
+
+var _ OutboxStore = (*SQLOutboxStore)(nil)
+
+// NewSQLOutboxStore builds a SQLOutboxStore using the default table name
+func NewSQLOutboxStore(db *sql.DB, placeholder SQLPlaceholder) *SQLOutboxStore {
+	return &SQLOutboxStore{DB: db, Placeholder: placeholder}
+}
+
+// CreateTable creates the outbox table and its index if they do not exist
+func (store *SQLOutboxStore) CreateTable(ctx context.Context) error {
+	table, err := sqlTableName(store.Table, defaultOutboxTable)
+	if err != nil {
+		return err
+	}
+
+	if _, err = store.DB.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(64) PRIMARY KEY,
+	kind VARCHAR(16) NOT NULL,
+	payload TEXT NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	attempts INTEGER NOT NULL,
+	next_attempt_at BIGINT NOT NULL,
+	claimed_until BIGINT NOT NULL,
+	message_id VARCHAR(64) NOT NULL,
+	error_code BIGINT NOT NULL,
+	error_message TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL
+)`, table)); err != nil {
+		return err
+	}
+
+	_, err = store.DB.ExecContext(ctx, fmt.Sprintf(
+		`CREATE INDEX IF NOT EXISTS %s_due ON %s (status, next_attempt_at)`,
+		safeIndexPrefix(table), table,
+	))
+	return err
+}
+
+// Enqueue saves a new message
+func (store *SQLOutboxStore) Enqueue(ctx context.Context, msg OutboxMessage, at time.Time) (OutboxMessage, error) {
+	return store.enqueue(ctx, store.DB, msg, at)
+}
+
+// EnqueueTx saves a new message as part of tx, so the email is only sent if the
+// transaction commits
+func (store *SQLOutboxStore) EnqueueTx(ctx context.Context, tx *sql.Tx, msg OutboxMessage, at time.Time) (OutboxMessage, error) {
+	return store.enqueue(ctx, tx, msg, at)
+}
+
+func (store *SQLOutboxStore) enqueue(ctx context.Context, db sqlExecer, msg OutboxMessage, at time.Time) (OutboxMessage, error) {
+	table, err := sqlTableName(store.Table, defaultOutboxTable)
+	if err != nil {
+		return msg, err
+	}
+
+	msg = prepareOutboxMessage(msg, at)
+	kind, payload, err := encodeOutboxPayload(msg)
+	if err != nil {
+		return msg, err
+	}
+
+	code, message := outboxErrorColumns(msg.Error)
+	_, err = db.ExecContext(ctx, store.Placeholder.rebind(fmt.Sprintf(`INSERT INTO %s
+	(id, kind, payload, status, attempts, next_attempt_at, claimed_until, message_id, error_code, error_message, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, table)),
+		msg.ID, kind, payload, string(msg.Status), msg.Attempts, sqlTime(msg.NextAttemptAt), sqlTime(msg.ClaimedUntil),
+		msg.MessageID, code, message, sqlTime(msg.CreatedAt), sqlTime(msg.UpdatedAt),
+	)
+	return msg, err
+}
+
+// Claim claims due messages. Candidates are selected first and then claimed one by
+// one with a conditional update, so concurrent dispatchers never claim the same message.
+func (store *SQLOutboxStore) Claim(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	table, err := sqlTableName(store.Table, defaultOutboxTable)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+
+	tx, err := store.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	due := `((status = ? AND next_attempt_at <= ?) OR (status = ? AND claimed_until <= ?))`
+	dueArgs := []interface{}{string(OutboxPending), sqlTime(now), string(OutboxClaimed), sqlTime(now)}
+
+	rows, err := tx.QueryContext(ctx, store.Placeholder.rebind(fmt.Sprintf(
+		`SELECT id FROM %s WHERE %s ORDER BY created_at LIMIT ?`, table, due,
+	)), append(dueArgs, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = errors.Join(rows.Err(), rows.Close()); err != nil {
+		return nil, err
+	}
+
+	claimed := make([]OutboxMessage, 0, len(ids))
+	for _, id := range ids {
+		res, err := tx.ExecContext(ctx, store.Placeholder.rebind(fmt.Sprintf(
+			`UPDATE %s SET status = ?, claimed_until = ?, updated_at = ? WHERE id = ? AND %s`, table, due,
+		)), append([]interface{}{string(OutboxClaimed), sqlTime(now.Add(lease)), sqlTime(now), id}, dueArgs...)...)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err != nil || n != 1 {
+			continue
+		}
+		msg, err := store.get(ctx, tx, table, id)
+		if err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, msg)
+	}
+
+	return claimed, tx.Commit()
+}
+
+// MarkSent records the MessageID returned by Postmark
+func (store *SQLOutboxStore) MarkSent(ctx context.Context, id string, messageID string, at time.Time) error {
+	return store.update(ctx, id,
+		`status = ?, attempts = attempts + 1, message_id = ?, error_code = 0, error_message = '', updated_at = ?`,
+		string(OutboxSent), messageID, sqlTime(at),
+	)
+}
+
+// MarkRetry returns a message to pending
+func (store *SQLOutboxStore) MarkRetry(ctx context.Context, id string, next time.Time, apiErr *APIError, at time.Time) error {
+	code, message := outboxErrorColumns(apiErr)
+	return store.update(ctx, id,
+		`status = ?, attempts = attempts + 1, next_attempt_at = ?, error_code = ?, error_message = ?, updated_at = ?`,
+		string(OutboxPending), sqlTime(next), code, message, sqlTime(at),
+	)
+}
+
+// MarkDead moves a message to the dead-letter state
+func (store *SQLOutboxStore) MarkDead(ctx context.Context, id string, apiErr *APIError, at time.Time) error {
+	code, message := outboxErrorColumns(apiErr)
+	return store.update(ctx, id,
+		`status = ?, attempts = attempts + 1, error_code = ?, error_message = ?, updated_at = ?`,
+		string(OutboxDead), code, message, sqlTime(at),
+	)
+}
+
+// Cancel moves a pending message to the canceled state
+func (store *SQLOutboxStore) Cancel(ctx context.Context, id string, at time.Time) error {
+	table, err := sqlTableName(store.Table, defaultOutboxTable)
+	if err != nil {
+		return err
+	}
+
+	res, err := store.DB.ExecContext(ctx, store.Placeholder.rebind(fmt.Sprintf(
+		`UPDATE %s SET status = ?, updated_at = ? WHERE id = ? AND status = ?`, table,
+	)), string(OutboxCanceled), sqlTime(at), id, string(OutboxPending))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return err
+	}
+	if _, err = store.get(ctx, store.DB, table, id); err != nil {
+		return err
+	}
+	return ErrOutboxMessageNotPending
+}
+
+// Get returns a message by ID
+func (store *SQLOutboxStore) Get(ctx context.Context, id string) (OutboxMessage, error) {
+	table, err := sqlTableName(store.Table, defaultOutboxTable)
+	if err != nil {
+		return OutboxMessage{}, err
+	}
+	return store.get(ctx, store.DB, table, id)
+}
+
+// List returns all messages with the given status, oldest first
+func (store *SQLOutboxStore) List(ctx context.Context, status OutboxStatus) ([]OutboxMessage, error) {
+	table, err := sqlTableName(store.Table, defaultOutboxTable)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := store.DB.QueryContext(ctx, store.Placeholder.rebind(fmt.Sprintf(
+		`SELECT %s FROM %s WHERE status = ? ORDER BY created_at`, outboxColumns, table,
+	)), string(status))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var res []OutboxMessage
+	for rows.Next() {
+		msg, err := scanOutboxMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, msg)
+	}
+	return res, rows.Err()
+}
+
+func (store *SQLOutboxStore) update(ctx context.Context, id string, set string, args ...interface{}) error {
+	table, err := sqlTableName(store.Table, defaultOutboxTable)
+	if err != nil {
+		return err
+	}
+
+	res, err := store.DB.ExecContext(ctx, store.Placeholder.rebind(fmt.Sprintf(
+		`UPDATE %s SET %s WHERE id = ?`, table, set,
+	)), append(args, id)...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrOutboxMessageNotFound
+	}
+	return nil
+}
+
+const outboxColumns = `id, kind, payload, status, attempts, next_attempt_at, claimed_until, message_id, error_code, error_message, created_at, updated_at`
+
+func (store *SQLOutboxStore) get(ctx context.Context, db sqlExecer, table, id string) (OutboxMessage, error) {
+	row := db.QueryRowContext(ctx, store.Placeholder.rebind(fmt.Sprintf(
+		`SELECT %s FROM %s WHERE id = ?`, outboxColumns, table,
+	)), id)
+	msg, err := scanOutboxMessage(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return msg, ErrOutboxMessageNotFound
+	}
+	return msg, err
+}
+
+func scanOutboxMessage(row interface {
+	Scan(dest ...interface{}) error
+}) (OutboxMessage, error) {
+	var (
+		msg                                               OutboxMessage
+		kind, payload, status, errMessage                 string
+		nextAttemptAt, claimedUntil, createdAt, updatedAt int64
+		errCode                                           int64
+	)
+	if err := row.Scan(&msg.ID, &kind, &payload, &status, &msg.Attempts, &nextAttemptAt, &claimedUntil,
+		&msg.MessageID, &errCode, &errMessage, &createdAt, &updatedAt); err != nil {
+		return msg, err
+	}
+
+	msg.Status = OutboxStatus(status)
+	msg.NextAttemptAt = fromSQLTime(nextAttemptAt)
+	msg.ClaimedUntil = fromSQLTime(claimedUntil)
+	msg.CreatedAt = fromSQLTime(createdAt)
+	msg.UpdatedAt = fromSQLTime(updatedAt)
+	if errCode != 0 || errMessage != "" {
+		msg.Error = &APIError{ErrorCode: errCode, Message: errMessage}
+	}
+	return msg, decodeOutboxPayload(&msg, kind, payload)
+}
+
+const (
+	outboxKindEmail     = "email"
+	outboxKindTemplated = "templated"
+)
+
+func encodeOutboxPayload(msg OutboxMessage) (string, string, error) {
+	var kind string
+	var payload interface{}
+	switch {
+	case msg.Email != nil:
+		kind, payload = outboxKindEmail, msg.Email
+	case msg.TemplatedEmail != nil:
+		kind, payload = outboxKindTemplated, msg.TemplatedEmail
+	default:
+		return "", "", errors.New("postmark: outbox message has no email")
+	}
+	data, err := json.Marshal(payload)
+	return kind, string(data), err
+}
+
+func decodeOutboxPayload(msg *OutboxMessage, kind, payload string) error {
+	switch kind {
+	case outboxKindEmail:
+		msg.Email = &Email{}
+		return json.Unmarshal([]byte(payload), msg.Email)
+	case outboxKindTemplated:
+		msg.TemplatedEmail = &TemplatedEmail{}
+		return json.Unmarshal([]byte(payload), msg.TemplatedEmail)
+	default:
+		return fmt.Errorf("postmark: unknown outbox message kind %q", kind)
+	}
+}
+
+func outboxErrorColumns(apiErr *APIError) (int64, string) {
+	if apiErr == nil {
+		return 0, ""
+	}
+	return apiErr.ErrorCode, apiErr.Message
+}
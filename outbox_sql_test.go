@@ -0,0 +1,227 @@
+package postmark
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newSQLiteOutboxStore(t *testing.T) *SQLOutboxStore {
+	t.Helper()
+
+	// Immediate transactions make concurrent claims wait for the write lock
+	// instead of failing when upgrading a read lock
+	dsn := "file:" + filepath.Join(t.TempDir(), "outbox.db") + "?_busy_timeout=5000&_txlock=immediate"
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	store := NewSQLOutboxStore(db, QuestionPlaceholder)
+	if err = store.CreateTable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestSQLOutboxStoreEnqueue(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteOutboxStore(t)
+	now := time.Now().Truncate(time.Millisecond)
+
+	email := Email{From: "sender@example.com", To: "recipient@example.com", Subject: "Hello", TextBody: "Hi"}
+	msg, err := store.Enqueue(ctx, NewOutboxEmail(email), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID == "" {
+		t.Fatal("Enqueue did not assign an ID")
+	}
+
+	got, err := store.Get(ctx, msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != OutboxPending || got.Email == nil || got.Email.Subject != "Hello" || got.TemplatedEmail != nil {
+		t.Fatalf("Get returned %+v", got)
+	}
+
+	if _, err = store.Enqueue(ctx, msg, now); err == nil {
+		t.Fatal("Enqueue accepted a duplicate ID")
+	}
+	if _, err = store.Get(ctx, "missing"); err != ErrOutboxMessageNotFound {
+		t.Fatalf("Get of a missing message returned %v", err)
+	}
+}
+
+func TestSQLOutboxStoreClaim(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteOutboxStore(t)
+	now := time.Now().Truncate(time.Millisecond)
+
+	due, err := store.Enqueue(ctx, NewOutboxEmail(Email{Subject: "due"}), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := NewOutboxEmail(Email{Subject: "later"})
+	later.NextAttemptAt = now.Add(time.Hour)
+	if _, err = store.Enqueue(ctx, later, now); err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := store.Claim(ctx, now, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0].ID != due.ID || claimed[0].Status != OutboxClaimed {
+		t.Fatalf("Claim returned %+v, want only the due message", claimed)
+	}
+
+	// The claim holds until its lease expires
+	if claimed, err = store.Claim(ctx, now.Add(30*time.Second), 10, time.Minute); err != nil || len(claimed) != 0 {
+		t.Fatalf("Claim during the lease returned %d messages, %v", len(claimed), err)
+	}
+	if claimed, err = store.Claim(ctx, now.Add(2*time.Minute), 10, time.Minute); err != nil || len(claimed) != 1 {
+		t.Fatalf("Claim after the lease returned %d messages, %v", len(claimed), err)
+	}
+}
+
+func TestSQLOutboxStoreClaimExclusive(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteOutboxStore(t)
+	now := time.Now()
+
+	const messages = 50
+	for i := 0; i < messages; i++ {
+		if _, err := store.Enqueue(ctx, NewOutboxEmail(Email{}), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	claims := map[string]int{}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				claimed, err := store.Claim(ctx, now, 3, time.Hour)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(claimed) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, msg := range claimed {
+					claims[msg.ID]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(claims) != messages {
+		t.Fatalf("%d messages claimed, want %d", len(claims), messages)
+	}
+	for id, n := range claims {
+		if n != 1 {
+			t.Errorf("message %s claimed %d times", id, n)
+		}
+	}
+}
+
+func TestSQLOutboxStoreMarkRetry(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteOutboxStore(t)
+	now := time.Now().Truncate(time.Millisecond)
+
+	msg, err := store.Enqueue(ctx, NewOutboxEmail(Email{}), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Claim(ctx, now, 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	at := now.Add(time.Second)
+	next := now.Add(time.Hour)
+	if err = store.MarkRetry(ctx, msg.ID, next, &APIError{ErrorCode: 429, Message: "rate limited"}, at); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Get(ctx, msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != OutboxPending || got.Attempts != 1 {
+		t.Fatalf("status %s after %d attempts, want pending after 1", got.Status, got.Attempts)
+	}
+	if !got.NextAttemptAt.Equal(next) || !got.UpdatedAt.Equal(at) {
+		t.Fatalf("NextAttemptAt %v, UpdatedAt %v, want %v and %v", got.NextAttemptAt, got.UpdatedAt, next, at)
+	}
+	if got.Error == nil || got.Error.ErrorCode != 429 || got.Error.Message != "rate limited" {
+		t.Fatalf("Error %+v", got.Error)
+	}
+
+	// The message is not due before next
+	if claimed, err := store.Claim(ctx, next.Add(-time.Second), 1, time.Minute); err != nil || len(claimed) != 0 {
+		t.Fatalf("Claim before the retry returned %d messages, %v", len(claimed), err)
+	}
+	if claimed, err := store.Claim(ctx, next, 1, time.Minute); err != nil || len(claimed) != 1 {
+		t.Fatalf("Claim at the retry returned %d messages, %v", len(claimed), err)
+	}
+}
+
+func TestSQLOutboxStoreMarkDead(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteOutboxStore(t)
+	now := time.Now().Truncate(time.Millisecond)
+
+	msg, err := store.Enqueue(ctx, NewOutboxEmail(Email{}), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Claim(ctx, now, 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	at := now.Add(time.Second)
+	if err = store.MarkDead(ctx, msg.ID, &APIError{ErrorCode: 300, Message: "invalid email request"}, at); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Get(ctx, msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != OutboxDead || got.Attempts != 1 || !got.UpdatedAt.Equal(at) {
+		t.Fatalf("status %s, %d attempts, updated at %v", got.Status, got.Attempts, got.UpdatedAt)
+	}
+	if got.Error == nil || got.Error.ErrorCode != 300 {
+		t.Fatalf("Error %+v", got.Error)
+	}
+
+	// Dead messages are never claimed again, nor canceled
+	if claimed, err := store.Claim(ctx, now.Add(24*time.Hour), 10, time.Minute); err != nil || len(claimed) != 0 {
+		t.Fatalf("Claim returned %d dead messages, %v", len(claimed), err)
+	}
+	if err = store.Cancel(ctx, msg.ID, now); err != ErrOutboxMessageNotPending {
+		t.Fatalf("Cancel of a dead message returned %v", err)
+	}
+	dead, err := store.List(ctx, OutboxDead)
+	if err != nil || len(dead) != 1 || dead[0].ID != msg.ID {
+		t.Fatalf("List returned %d dead messages, %v", len(dead), err)
+	}
+}
@@ -0,0 +1,165 @@
+package postmark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// rejectingSender answers like Client.SendEmail when Postmark rejects a
+// message: an error code in the response and a plain error
+type rejectingSender struct {
+	*CaptureSender
+}
+
+func (sender rejectingSender) SendEmail(_ context.Context, _ Email) (EmailResponse, error) {
+	res := EmailResponse{ErrorCode: 300, Message: "Invalid email request"}
+	return res, fmt.Errorf("%v %s", res.ErrorCode, res.Message)
+}
+
+// newTestOutboxDispatcher returns a dispatcher on a memory store, with a clock
+// set to now and a backoff of one minute per attempt
+func newTestOutboxDispatcher(sender Sender, now *time.Time) (*OutboxDispatcher, *MemoryOutboxStore) {
+	store := NewMemoryOutboxStore()
+	d := NewOutboxDispatcher(store, sender)
+	d.Now = func() time.Time { return *now }
+	d.Backoff = func(attempt int) time.Duration { return time.Duration(attempt) * time.Minute }
+	return d, store
+}
+
+func TestOutboxDispatcherSent(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	sender := &CaptureSender{}
+	d, store := newTestOutboxDispatcher(sender, &now)
+
+	msg, err := store.Enqueue(ctx, NewOutboxEmail(Email{To: "recipient@example.com", Subject: "Hello"}), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Second)
+	if n, err := d.DispatchOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("DispatchOnce returned %d, %v", n, err)
+	}
+
+	got, err := store.Get(ctx, msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != OutboxSent || got.MessageID != "captured-1" || !got.UpdatedAt.Equal(now) {
+		t.Fatalf("status %s, message ID %q, updated at %v", got.Status, got.MessageID, got.UpdatedAt)
+	}
+	if emails := sender.Emails(); len(emails) != 1 || emails[0].Subject != "Hello" {
+		t.Fatalf("sent %+v", emails)
+	}
+
+	// Sent messages are not claimed again
+	if n, err := d.DispatchOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("DispatchOnce after sending returned %d, %v", n, err)
+	}
+}
+
+func TestOutboxDispatcherRetry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	sender := &CaptureSender{Err: errors.New("connection reset by peer")}
+	d, store := newTestOutboxDispatcher(sender, &now)
+	d.MaxAttempts = 3
+
+	msg, err := store.Enqueue(ctx, NewOutboxEmail(Email{}), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt := 1; attempt < d.MaxAttempts; attempt++ {
+		if n, err := d.DispatchOnce(ctx); err != nil || n != 1 {
+			t.Fatalf("attempt %d: DispatchOnce returned %d, %v", attempt, n, err)
+		}
+		got, err := store.Get(ctx, msg.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next := now.Add(time.Duration(attempt) * time.Minute)
+		if got.Status != OutboxPending || got.Attempts != attempt {
+			t.Fatalf("attempt %d: status %s after %d attempts", attempt, got.Status, got.Attempts)
+		}
+		if !got.NextAttemptAt.Equal(next) || !got.UpdatedAt.Equal(now) {
+			t.Fatalf("attempt %d: NextAttemptAt %v, UpdatedAt %v, want %v and %v", attempt, got.NextAttemptAt, got.UpdatedAt, next, now)
+		}
+		if got.Error == nil || got.Error.Message != "connection reset by peer" {
+			t.Fatalf("attempt %d: Error %+v", attempt, got.Error)
+		}
+
+		// The message waits for its backoff
+		now = next.Add(-time.Second)
+		if n, err := d.DispatchOnce(ctx); err != nil || n != 0 {
+			t.Fatalf("attempt %d: DispatchOnce before the backoff returned %d, %v", attempt, n, err)
+		}
+		now = next
+	}
+
+	// The last attempt dead-letters the message
+	if n, err := d.DispatchOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("last attempt: DispatchOnce returned %d, %v", n, err)
+	}
+	got, err := store.Get(ctx, msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != OutboxDead || got.Attempts != d.MaxAttempts || !got.UpdatedAt.Equal(now) {
+		t.Fatalf("status %s after %d attempts, updated at %v", got.Status, got.Attempts, got.UpdatedAt)
+	}
+	if got.Error == nil || got.Error.Message != "connection reset by peer" {
+		t.Fatalf("Error %+v", got.Error)
+	}
+}
+
+func TestOutboxDispatcherPermanent(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		sender  Sender
+		code    int64
+		message string
+	}{
+		{
+			name:    "APIError",
+			sender:  &CaptureSender{Err: APIError{ErrorCode: 406, Message: "Inactive recipient"}},
+			code:    406,
+			message: "Inactive recipient",
+		},
+		{
+			name:    "error code",
+			sender:  rejectingSender{&CaptureSender{}},
+			code:    300,
+			message: "Invalid email request",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+			d, store := newTestOutboxDispatcher(test.sender, &now)
+
+			msg, err := store.Enqueue(ctx, NewOutboxEmail(Email{}), now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n, err := d.DispatchOnce(ctx); err != nil || n != 1 {
+				t.Fatalf("DispatchOnce returned %d, %v", n, err)
+			}
+
+			got, err := store.Get(ctx, msg.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != OutboxDead || got.Attempts != 1 {
+				t.Fatalf("status %s after %d attempts, want dead after 1", got.Status, got.Attempts)
+			}
+			if got.Error == nil || got.Error.ErrorCode != test.code || got.Error.Message != test.message {
+				t.Fatalf("Error %+v", got.Error)
+			}
+		})
+	}
+}
@@ -22,6 +22,9 @@ type Client struct {
 	AccountToken string
 	// BaseURL is the root API endpoint
 	BaseURL string
+	// GenerateTextBody derives the TextBody from the HTMLBody when it is empty, for
+	// emails sent with SendEmail or SendEmailBatch and templates created with CreateTemplate
+	GenerateTextBody bool
 }
 
 const (
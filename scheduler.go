@@ -0,0 +1,93 @@
+package postmark
+
+import (
+	"context"
+	"time"
+)
+
+// Scheduler sends emails at a later time. Postmark has no scheduled sending, so
+// jobs are persisted as outbox messages due at their send time and fired by an
+// OutboxDispatcher. With a durable OutboxStore, jobs survive restarts.
+type Scheduler struct {
+	// Store persists the scheduled jobs
+	Store OutboxStore
+	// Dispatcher fires due jobs, its Now is used as the scheduler clock
+	Dispatcher *OutboxDispatcher
+}
+
+// NewScheduler builds a Scheduler which persists jobs in store and sends them with sender
+func NewScheduler(store OutboxStore, sender Sender) *Scheduler {
+	dispatcher := NewOutboxDispatcher(store, sender)
+	dispatcher.PollInterval = time.Second
+	return &Scheduler{Store: store, Dispatcher: dispatcher}
+}
+
+// ScheduleEmail schedules email to be sent at sendAt. If timeZone is set (an IANA
+// name such as "Europe/Berlin"), the date and clock of sendAt are interpreted in
+// that time zone, so 9:00 means 9am recipient local time.
+// The returned OutboxMessage ID identifies the job for Cancel.
+func (s *Scheduler) ScheduleEmail(ctx context.Context, email Email, sendAt time.Time, timeZone string) (OutboxMessage, error) {
+	msg := NewOutboxEmail(email)
+	return s.schedule(ctx, msg, sendAt, timeZone)
+}
+
+// ScheduleTemplatedEmail schedules email to be sent at sendAt, see ScheduleEmail
+func (s *Scheduler) ScheduleTemplatedEmail(ctx context.Context, email TemplatedEmail, sendAt time.Time, timeZone string) (OutboxMessage, error) {
+	msg := NewOutboxTemplatedEmail(email)
+	return s.schedule(ctx, msg, sendAt, timeZone)
+}
+
+func (s *Scheduler) schedule(ctx context.Context, msg OutboxMessage, sendAt time.Time, timeZone string) (OutboxMessage, error) {
+	at, err := InTimeZone(sendAt, timeZone)
+	if err != nil {
+		return msg, err
+	}
+	msg.NextAttemptAt = at
+	return s.Store.Enqueue(ctx, msg, s.Dispatcher.now())
+}
+
+// Cancel cancels a scheduled job which has not been sent yet
+func (s *Scheduler) Cancel(ctx context.Context, id string) error {
+	return s.Store.Cancel(ctx, id, s.Dispatcher.now())
+}
+
+// Get returns a scheduled job by ID
+func (s *Scheduler) Get(ctx context.Context, id string) (OutboxMessage, error) {
+	return s.Store.Get(ctx, id)
+}
+
+// Pending returns the jobs which have not been sent yet, including jobs waiting for a retry
+func (s *Scheduler) Pending(ctx context.Context) ([]OutboxMessage, error) {
+	return s.Store.List(ctx, OutboxPending)
+}
+
+// Run fires due jobs until ctx is done
+func (s *Scheduler) Run(ctx context.Context) error {
+	return s.Dispatcher.Run(ctx)
+}
+
+// FireDue sends the jobs which are due now and returns how many were fired. It is
+// useful with an injected clock, to step through time in tests.
+func (s *Scheduler) FireDue(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		n, err := s.Dispatcher.DispatchOnce(ctx)
+		total += n
+		if err != nil || n < s.Dispatcher.batchSize() {
+			return total, err
+		}
+	}
+}
+
+// InTimeZone returns the instant at which the wall clock in timeZone shows the date
+// and clock of t. An empty timeZone returns t unchanged.
+func InTimeZone(t time.Time, timeZone string) (time.Time, error) {
+	if timeZone == "" {
+		return t, nil
+	}
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return t, err
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc), nil
+}
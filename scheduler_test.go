@@ -0,0 +1,86 @@
+package postmark
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSchedulerFireDue(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, time.March, 1, 8, 0, 0, 0, time.UTC)
+	now := start
+
+	sender := &CaptureSender{}
+	scheduler := NewScheduler(NewMemoryOutboxStore(), sender)
+	scheduler.Dispatcher.Now = func() time.Time { return now }
+
+	reminder, err := scheduler.ScheduleEmail(ctx, Email{Subject: "reminder"}, start.Add(time.Hour), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reminder.CreatedAt.Equal(start) {
+		t.Fatalf("CreatedAt %v, want the scheduler clock %v", reminder.CreatedAt, start)
+	}
+	canceled, err := scheduler.ScheduleEmail(ctx, Email{Subject: "canceled"}, start.Add(time.Hour), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 9:00 in Berlin is 8:00 UTC in March
+	digestJob, err := scheduler.ScheduleTemplatedEmail(ctx, TemplatedEmail{TemplateAlias: "digest"}, time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC), "Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = start.Add(time.Minute)
+	if err = scheduler.Cancel(ctx, canceled.ID); err != nil {
+		t.Fatal(err)
+	}
+	job, err := scheduler.Get(ctx, canceled.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != OutboxCanceled || !job.UpdatedAt.Equal(now) {
+		t.Fatalf("canceled job is %s, updated at %v", job.Status, job.UpdatedAt)
+	}
+
+	// Only the digest is due at 8:00 UTC
+	if n, err := scheduler.FireDue(ctx); err != nil || n != 1 {
+		t.Fatalf("FireDue fired %d jobs at %v, %v", n, now, err)
+	}
+	digest := sender.TemplatedEmails()
+	if len(digest) != 1 || digest[0].TemplateAlias != "digest" || len(sender.Emails()) != 0 {
+		t.Fatalf("sent %+v and %+v, want only the digest", digest, sender.Emails())
+	}
+	if job, err = scheduler.Get(ctx, digestJob.ID); err != nil || job.MessageID != "captured-templated-1" {
+		t.Fatalf("digest has MessageID %q, %v", job.MessageID, err)
+	}
+	pending, err := scheduler.Pending(ctx)
+	if err != nil || len(pending) != 1 || pending[0].ID != reminder.ID {
+		t.Fatalf("Pending returned %d jobs, %v", len(pending), err)
+	}
+
+	now = start.Add(time.Hour - time.Second)
+	if n, err := scheduler.FireDue(ctx); err != nil || n != 0 {
+		t.Fatalf("FireDue fired %d jobs before they were due, %v", n, err)
+	}
+
+	now = start.Add(time.Hour)
+	if n, err := scheduler.FireDue(ctx); err != nil || n != 1 {
+		t.Fatalf("FireDue fired %d jobs at %v, %v", n, now, err)
+	}
+	job, err = scheduler.Get(ctx, reminder.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != OutboxSent || job.MessageID != "captured-1" || !job.UpdatedAt.Equal(now) {
+		t.Fatalf("reminder is %s with MessageID %q, updated at %v", job.Status, job.MessageID, job.UpdatedAt)
+	}
+
+	if err = scheduler.Cancel(ctx, reminder.ID); err != ErrOutboxMessageNotPending {
+		t.Fatalf("Cancel of a sent job returned %v", err)
+	}
+	if emails := sender.Emails(); len(emails) != 1 || emails[0].Subject != "reminder" {
+		t.Fatalf("sent %+v, want only the reminder", emails)
+	}
+}
@@ -0,0 +1,222 @@
+package postmark
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Sender sends emails. It is implemented by Client, and allows application code
+// to be tested or routed through other transports without depending on Client.
+type Sender interface {
+	// SendEmail sends a single email
+	SendEmail(ctx context.Context, email Email) (EmailResponse, error)
+	// SendEmailBatch sends multiple emails together
+	SendEmailBatch(ctx context.Context, emails []Email) ([]EmailResponse, error)
+	// SendTemplatedEmail sends a single email using a template
+	SendTemplatedEmail(ctx context.Context, email TemplatedEmail) (EmailResponse, error)
+	// SendTemplatedEmailBatch sends multiple emails using templates
+	SendTemplatedEmailBatch(ctx context.Context, emails []TemplatedEmail) ([]EmailResponse, error)
+}
+
+var _ Sender = (*Client)(nil)
+
+// NopSender is a Sender which does not send anything. Every email is reported
+// as successfully submitted, and logged to Logger if it is set.
+type NopSender struct {
+	// Logger receives one line per email, nothing is logged if nil
+	Logger *log.Logger
+}
+
+var _ Sender = NopSender{}
+
+// SendEmail logs the email and returns a successful response
+func (sender NopSender) SendEmail(_ context.Context, email Email) (EmailResponse, error) {
+	sender.logf("postmark: not sending email to %q, subject %q", email.To, email.Subject)
+	return okResponse(email.To, ""), nil
+}
+
+// SendEmailBatch logs the emails and returns a successful response for each
+func (sender NopSender) SendEmailBatch(ctx context.Context, emails []Email) ([]EmailResponse, error) {
+	res := make([]EmailResponse, 0, len(emails))
+	for _, email := range emails {
+		r, _ := sender.SendEmail(ctx, email)
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+// SendTemplatedEmail logs the email and returns a successful response
+func (sender NopSender) SendTemplatedEmail(_ context.Context, email TemplatedEmail) (EmailResponse, error) {
+	sender.logf("postmark: not sending templated email to %q, template %s", email.To, templateRef(email))
+	return okResponse(email.To, ""), nil
+}
+
+// SendTemplatedEmailBatch logs the emails and returns a successful response for each
+func (sender NopSender) SendTemplatedEmailBatch(ctx context.Context, emails []TemplatedEmail) ([]EmailResponse, error) {
+	res := make([]EmailResponse, 0, len(emails))
+	for _, email := range emails {
+		r, _ := sender.SendTemplatedEmail(ctx, email)
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+func (sender NopSender) logf(format string, args ...interface{}) {
+	if sender.Logger != nil {
+		sender.Logger.Printf(format, args...)
+	}
+}
+
+// CaptureSender is a Sender which keeps every email in memory instead of sending
+// it, so tests can assert on what would have been sent. It is safe for concurrent use.
+type CaptureSender struct {
+	mu              sync.Mutex
+	emails          []Email
+	templatedEmails []TemplatedEmail
+	// Err, when set, is returned by every send call and nothing is captured
+	Err error
+}
+
+var _ Sender = (*CaptureSender)(nil)
+
+// SendEmail captures the email
+func (sender *CaptureSender) SendEmail(_ context.Context, email Email) (EmailResponse, error) {
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	if sender.Err != nil {
+		return EmailResponse{}, sender.Err
+	}
+	sender.emails = append(sender.emails, email)
+	return okResponse(email.To, fmt.Sprintf("captured-%d", len(sender.emails))), nil
+}
+
+// SendEmailBatch captures the emails
+func (sender *CaptureSender) SendEmailBatch(ctx context.Context, emails []Email) ([]EmailResponse, error) {
+	res := make([]EmailResponse, 0, len(emails))
+	for _, email := range emails {
+		r, err := sender.SendEmail(ctx, email)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+// SendTemplatedEmail captures the email
+func (sender *CaptureSender) SendTemplatedEmail(_ context.Context, email TemplatedEmail) (EmailResponse, error) {
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	if sender.Err != nil {
+		return EmailResponse{}, sender.Err
+	}
+	sender.templatedEmails = append(sender.templatedEmails, email)
+	return okResponse(email.To, fmt.Sprintf("captured-templated-%d", len(sender.templatedEmails))), nil
+}
+
+// SendTemplatedEmailBatch captures the emails
+func (sender *CaptureSender) SendTemplatedEmailBatch(ctx context.Context, emails []TemplatedEmail) ([]EmailResponse, error) {
+	res := make([]EmailResponse, 0, len(emails))
+	for _, email := range emails {
+		r, err := sender.SendTemplatedEmail(ctx, email)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+// Emails returns a copy of the captured emails, in the order they were sent
+func (sender *CaptureSender) Emails() []Email {
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	return append([]Email(nil), sender.emails...)
+}
+
+// TemplatedEmails returns a copy of the captured templated emails, in the order they were sent
+func (sender *CaptureSender) TemplatedEmails() []TemplatedEmail {
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	return append([]TemplatedEmail(nil), sender.templatedEmails...)
+}
+
+// Reset removes all captured emails
+func (sender *CaptureSender) Reset() {
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	sender.emails = nil
+	sender.templatedEmails = nil
+}
+
+// MirrorSender sends every email through Primary and mirrors it to Shadow, for
+// shadow testing a new transport or account. Only Primary's results are returned.
+type MirrorSender struct {
+	// Primary is the Sender whose results are returned to the caller
+	Primary Sender
+	// Shadow receives a copy of every email after Primary
+	Shadow Sender
+	// OnShadowError is called with any error returned by Shadow, errors are ignored if nil
+	OnShadowError func(error)
+}
+
+var _ Sender = MirrorSender{}
+
+// SendEmail sends the email through Primary and Shadow
+func (sender MirrorSender) SendEmail(ctx context.Context, email Email) (EmailResponse, error) {
+	res, err := sender.Primary.SendEmail(ctx, email)
+	_, shadowErr := sender.Shadow.SendEmail(ctx, email)
+	sender.shadowError(shadowErr)
+	return res, err
+}
+
+// SendEmailBatch sends the emails through Primary and Shadow
+func (sender MirrorSender) SendEmailBatch(ctx context.Context, emails []Email) ([]EmailResponse, error) {
+	res, err := sender.Primary.SendEmailBatch(ctx, emails)
+	_, shadowErr := sender.Shadow.SendEmailBatch(ctx, emails)
+	sender.shadowError(shadowErr)
+	return res, err
+}
+
+// SendTemplatedEmail sends the email through Primary and Shadow
+func (sender MirrorSender) SendTemplatedEmail(ctx context.Context, email TemplatedEmail) (EmailResponse, error) {
+	res, err := sender.Primary.SendTemplatedEmail(ctx, email)
+	_, shadowErr := sender.Shadow.SendTemplatedEmail(ctx, email)
+	sender.shadowError(shadowErr)
+	return res, err
+}
+
+// SendTemplatedEmailBatch sends the emails through Primary and Shadow
+func (sender MirrorSender) SendTemplatedEmailBatch(ctx context.Context, emails []TemplatedEmail) ([]EmailResponse, error) {
+	res, err := sender.Primary.SendTemplatedEmailBatch(ctx, emails)
+	_, shadowErr := sender.Shadow.SendTemplatedEmailBatch(ctx, emails)
+	sender.shadowError(shadowErr)
+	return res, err
+}
+
+func (sender MirrorSender) shadowError(err error) {
+	if err != nil && sender.OnShadowError != nil {
+		sender.OnShadowError(err)
+	}
+}
+
+// okResponse builds a successful EmailResponse for senders which do not talk to Postmark
+func okResponse(to, messageID string) EmailResponse {
+	return EmailResponse{
+		To:          to,
+		SubmittedAt: time.Now(),
+		MessageID:   messageID,
+		Message:     "OK",
+	}
+}
+
+// templateRef describes the template used by email, for logging
+func templateRef(email TemplatedEmail) string {
+	if email.TemplateAlias != "" {
+		return email.TemplateAlias
+	}
+	return fmt.Sprintf("%d", email.TemplateID)
+}
@@ -0,0 +1,267 @@
+package postmark
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// postmarkSMTPHost is the SMTP endpoint for transactional streams
+	postmarkSMTPHost = "smtp.postmarkapp.com"
+	// postmarkSMTPBroadcastHost is the SMTP endpoint for broadcast streams
+	postmarkSMTPBroadcastHost = "smtp-broadcasts.postmarkapp.com"
+	// postmarkSMTPPort is the submission port, 25 and 2525 are also accepted
+	postmarkSMTPPort = 587
+)
+
+// SMTPSender sends emails through Postmark's SMTP endpoint instead of the HTTP API.
+// Postmark specific fields of Email are mapped onto the X-PM-* headers.
+// https://postmarkapp.com/developer/user-guide/send-email-with-smtp
+type SMTPSender struct {
+	// Host of the SMTP server, smtp.postmarkapp.com by default
+	Host string
+	// Port of the SMTP server, 587 by default
+	Port int
+	// Username: the server token by default
+	Username string
+	// Password: the server token by default
+	Password string
+	// TLSConfig is used for STARTTLS. If nil, a config with ServerName set to Host is used.
+	TLSConfig *tls.Config
+	// AllowInsecure sends without STARTTLS when the server does not offer it. This
+	// should only be used against a local SMTP stand-in.
+	AllowInsecure bool
+	// LocalName is sent with HELO/EHLO, "localhost" by default
+	LocalName string
+	// Dialer is used to open the connection, &net.Dialer{} by default
+	Dialer *net.Dialer
+}
+
+// NewSMTPSender builds a new SMTPSender pointer using the provided server token
+// as SMTP credentials and Postmark's transactional SMTP endpoint.
+func NewSMTPSender(serverToken string) *SMTPSender {
+	return &SMTPSender{
+		Host:     postmarkSMTPHost,
+		Port:     postmarkSMTPPort,
+		Username: serverToken,
+		Password: serverToken,
+		Dialer:   &net.Dialer{Timeout: 30 * time.Second},
+	}
+}
+
+// NewSMTPBroadcastSender is like NewSMTPSender but uses Postmark's broadcast SMTP endpoint.
+func NewSMTPBroadcastSender(serverToken string) *SMTPSender {
+	sender := NewSMTPSender(serverToken)
+	sender.Host = postmarkSMTPBroadcastHost
+	return sender
+}
+
+// SendEmail sends the email over SMTP. The returned EmailResponse has MessageID set
+// when the server reports it in its reply to the message data.
+func (sender *SMTPSender) SendEmail(ctx context.Context, email Email) (EmailResponse, error) {
+	res := EmailResponse{To: email.To}
+
+	from, recipients, err := smtpEnvelope(email)
+	if err != nil {
+		return res, err
+	}
+
+	var msg bytes.Buffer
+	if err = smtpEmail(email).WriteMIME(&msg); err != nil {
+		return res, err
+	}
+
+	reply, err := sender.send(ctx, from, recipients, msg.Bytes())
+	if err != nil {
+		return res, err
+	}
+
+	res.SubmittedAt = time.Now()
+	res.Message = reply
+	res.MessageID = smtpMessageID(reply)
+	return res, nil
+}
+
+// send runs the SMTP conversation and returns the server's reply to the message data
+func (sender *SMTPSender) send(ctx context.Context, from string, recipients []string, msg []byte) (reply string, err error) {
+	host := sender.Host
+	if host == "" {
+		host = postmarkSMTPHost
+	}
+	port := sender.Port
+	if port == 0 {
+		port = postmarkSMTPPort
+	}
+	dialer := sender.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return "", err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return "", err
+	}
+	defer func() {
+		_ = c.Close()
+	}()
+
+	if err = c.Hello(sender.localName()); err != nil {
+		return "", err
+	}
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		tlsConfig := sender.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: host}
+		}
+		if err = c.StartTLS(tlsConfig); err != nil {
+			return "", err
+		}
+	} else if !sender.AllowInsecure {
+		return "", errors.New("postmark: SMTP server does not support STARTTLS")
+	}
+
+	if sender.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return "", errors.New("postmark: SMTP server does not support AUTH")
+		}
+		if err = c.Auth(smtp.PlainAuth("", sender.Username, sender.Password, host)); err != nil {
+			return "", err
+		}
+	}
+
+	if err = c.Mail(from); err != nil {
+		return "", err
+	}
+	for _, rcpt := range recipients {
+		if err = c.Rcpt(rcpt); err != nil {
+			return "", err
+		}
+	}
+
+	// smtp.Client.Data discards the final reply, which is where Postmark reports
+	// the message ID, so the DATA command is issued on the underlying connection.
+	id, err := c.Text.Cmd("DATA")
+	if err != nil {
+		return "", err
+	}
+	c.Text.StartResponse(id)
+	_, _, err = c.Text.ReadResponse(354)
+	c.Text.EndResponse(id)
+	if err != nil {
+		return "", err
+	}
+
+	dw := c.Text.DotWriter()
+	if _, err = dw.Write(msg); err != nil {
+		return "", err
+	}
+	if err = dw.Close(); err != nil {
+		return "", err
+	}
+	if _, reply, err = c.Text.ReadResponse(250); err != nil {
+		return "", err
+	}
+
+	// The message was accepted, so a failing QUIT must not be reported as a
+	// failed send, which callers would retry
+	_ = c.Quit()
+	return reply, nil
+}
+
+func (sender *SMTPSender) localName() string {
+	if sender.LocalName != "" {
+		return sender.LocalName
+	}
+	return "localhost"
+}
+
+// smtpEmail returns a copy of email with Postmark specific fields mapped onto X-PM-* headers
+func smtpEmail(email Email) Email {
+	headers := make([]Header, 0, len(email.Headers)+len(email.Metadata)+4)
+	headers = append(headers, email.Headers...)
+
+	if email.MessageStream != "" {
+		headers = append(headers, Header{Name: "X-PM-Message-Stream", Value: email.MessageStream})
+	}
+	if email.Tag != "" {
+		headers = append(headers, Header{Name: "X-PM-Tag", Value: email.Tag})
+	}
+	if email.TrackOpens {
+		headers = append(headers, Header{Name: "X-PM-TrackOpens", Value: "true"})
+	}
+	if email.TrackLinks != "" {
+		headers = append(headers, Header{Name: "X-PM-TrackLinks", Value: email.TrackLinks})
+	}
+
+	keys := make([]string, 0, len(email.Metadata))
+	for k := range email.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		headers = append(headers, Header{Name: "X-PM-Metadata-" + k, Value: email.Metadata[k]})
+	}
+
+	email.Headers = headers
+	return email
+}
+
+// smtpEnvelope returns the envelope sender and recipients of email
+func smtpEnvelope(email Email) (string, []string, error) {
+	from, err := mail.ParseAddress(email.From)
+	if err != nil {
+		return "", nil, fmt.Errorf("postmark: invalid From address: %w", err)
+	}
+
+	var recipients []string
+	for _, list := range []string{email.To, email.Cc, email.Bcc} {
+		if strings.TrimSpace(list) == "" {
+			continue
+		}
+		addresses, err := mail.ParseAddressList(list)
+		if err != nil {
+			return "", nil, fmt.Errorf("postmark: invalid recipient address: %w", err)
+		}
+		for _, addr := range addresses {
+			recipients = append(recipients, addr.Address)
+		}
+	}
+	if len(recipients) == 0 {
+		return "", nil, errors.New("postmark: email has no recipients")
+	}
+
+	return from.Address, recipients, nil
+}
+
+// smtpMessageID extracts the message ID from a reply such as "Ok: queued as <id>"
+func smtpMessageID(reply string) string {
+	fields := strings.Fields(reply)
+	if len(fields) < 3 || !strings.EqualFold(fields[len(fields)-3], "queued") {
+		return ""
+	}
+	return strings.Trim(fields[len(fields)-1], "<>")
+}
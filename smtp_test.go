@@ -0,0 +1,166 @@
+package postmark
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// smtpSession is what a stand-in SMTP server received
+type smtpSession struct {
+	auth       string
+	from       string
+	recipients []string
+	data       []byte
+	quit       bool
+}
+
+// newSMTPStandIn serves one SMTP session without STARTTLS on a local port, and
+// returns a sender to it and the received session once the client disconnects
+func newSMTPStandIn(t *testing.T, reply string) (*SMTPSender, <-chan smtpSession) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = ln.Close()
+	})
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		var session smtpSession
+		defer func() {
+			sessions <- session
+		}()
+
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		text := textproto.NewConn(conn)
+		_ = text.PrintfLine("220 stand-in ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(cmd) {
+			case "EHLO":
+				_ = text.PrintfLine("250-stand-in")
+				_ = text.PrintfLine("250 AUTH PLAIN")
+			case "AUTH":
+				_, resp, _ := strings.Cut(arg, " ")
+				auth, _ := base64.StdEncoding.DecodeString(resp)
+				session.auth = string(auth)
+				_ = text.PrintfLine("235 2.7.0 Authentication successful")
+			case "MAIL":
+				session.from = arg
+				_ = text.PrintfLine("250 Ok")
+			case "RCPT":
+				session.recipients = append(session.recipients, arg)
+				_ = text.PrintfLine("250 Ok")
+			case "DATA":
+				_ = text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+				if session.data, err = text.ReadDotBytes(); err != nil {
+					return
+				}
+				_ = text.PrintfLine("%s", reply)
+			case "QUIT":
+				session.quit = true
+				_ = text.PrintfLine("221 Bye")
+				return
+			default:
+				_ = text.PrintfLine("502 Command not implemented")
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	sender := NewSMTPSender("server-token")
+	sender.Host = addr.IP.String()
+	sender.Port = addr.Port
+	return sender, sessions
+}
+
+func TestSMTPSenderSendEmail(t *testing.T) {
+	sender, sessions := newSMTPStandIn(t, "250 Ok: queued as 0a129aee-e1cd-480d-b08d-4f48548ff48d")
+	sender.AllowInsecure = true
+
+	res, err := sender.SendEmail(context.Background(), Email{
+		From:          "Sender <sender@example.com>",
+		To:            "recipient@example.com",
+		Cc:            "copy@example.com",
+		Bcc:           "hidden@example.com",
+		Subject:       "Welcome",
+		TextBody:      "Hello",
+		Tag:           "welcome",
+		TrackOpens:    true,
+		TrackLinks:    "HtmlAndText",
+		Metadata:      map[string]string{"client-id": "42", "plan": "pro"},
+		MessageStream: "outbound",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.MessageID != "0a129aee-e1cd-480d-b08d-4f48548ff48d" || res.To != "recipient@example.com" {
+		t.Fatalf("SendEmail returned %+v", res)
+	}
+
+	session := <-sessions
+	if session.auth != "\x00server-token\x00server-token" {
+		t.Errorf("authenticated with %q, want the server token", session.auth)
+	}
+	if session.from != "FROM:<sender@example.com>" {
+		t.Errorf("MAIL %s", session.from)
+	}
+	if want := []string{"TO:<recipient@example.com>", "TO:<copy@example.com>", "TO:<hidden@example.com>"}; !reflect.DeepEqual(session.recipients, want) {
+		t.Errorf("RCPT %v, want %v", session.recipients, want)
+	}
+	if !session.quit {
+		t.Error("the session was not ended with QUIT")
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(session.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"Subject":                 "Welcome",
+		"X-PM-Message-Stream":     "outbound",
+		"X-PM-Tag":                "welcome",
+		"X-PM-TrackOpens":         "true",
+		"X-PM-TrackLinks":         "HtmlAndText",
+		"X-PM-Metadata-client-id": "42",
+		"X-PM-Metadata-plan":      "pro",
+		"Bcc":                     "",
+	} {
+		if got := msg.Header.Get(name); got != want {
+			t.Errorf("header %s is %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSMTPSenderRequiresSTARTTLS(t *testing.T) {
+	sender, sessions := newSMTPStandIn(t, "250 Ok")
+
+	_, err := sender.SendEmail(context.Background(), Email{From: "sender@example.com", To: "recipient@example.com"})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("SendEmail without STARTTLS returned %v", err)
+	}
+	if session := <-sessions; session.auth != "" || session.data != nil {
+		t.Fatalf("credentials or data were sent in the clear: %+v", session)
+	}
+}
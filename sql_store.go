@@ -0,0 +1,83 @@
+package postmark
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLPlaceholder is the bind parameter syntax of a database/sql driver
+type SQLPlaceholder int
+
+const (
+	// QuestionPlaceholder uses "?" parameters, as SQLite and MySQL do
+	QuestionPlaceholder SQLPlaceholder = iota
+	// DollarPlaceholder uses "$1" parameters, as PostgreSQL does
+	DollarPlaceholder
+)
+
+// validSQLTable matches the table names accepted by the SQL stores, as they are
+// interpolated into queries
+var validSQLTable = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// sqlExecer is implemented by *sql.DB and *sql.Tx
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// rebind rewrites the "?" parameters of query for the placeholder style
+func (p SQLPlaceholder) rebind(query string) string {
+	if p != DollarPlaceholder {
+		return query
+	}
+	var sb strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// sqlTableName validates table, falling back to def when empty
+func sqlTableName(table, def string) (string, error) {
+	if table == "" {
+		return def, nil
+	}
+	if !validSQLTable.MatchString(table) {
+		return "", fmt.Errorf("postmark: invalid table name %q", table)
+	}
+	return table, nil
+}
+
+// sqlTime converts a timestamp to the integer stored in the database, zero
+// times are stored as 0
+func sqlTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromSQLTime converts a stored integer back to a timestamp
+func fromSQLTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// safeIndexPrefix derives an index name prefix from a possibly schema qualified table name
+func safeIndexPrefix(table string) string {
+	return strings.ReplaceAll(table, ".", "_")
+}
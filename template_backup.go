@@ -0,0 +1,360 @@
+package postmark
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TemplateBackupVersion is the version of the archive format written by ExportTemplates
+const TemplateBackupVersion = 1
+
+const templateBackupManifest = "manifest.json"
+
+// ErrTemplateAliasConflict is returned by ImportTemplates when templates of the
+// backup collide with existing aliases and the conflict policy is TemplateConflictFail
+var ErrTemplateAliasConflict = errors.New("postmark: template alias conflict")
+
+// TemplateBackupManifest describes the content of a template backup
+type TemplateBackupManifest struct {
+	// Version of the archive format
+	Version int
+	// CreatedAt: time of the export
+	CreatedAt time.Time
+	// ServerID: ID of the exported server, when known
+	ServerID int64 `json:",omitempty"`
+	// Templates in the archive, layouts first
+	Templates []TemplateBackupEntry
+}
+
+// TemplateBackupEntry is a template of a TemplateBackupManifest
+type TemplateBackupEntry struct {
+	TemplateID     int64 `json:"TemplateID"`
+	Name           string
+	Alias          string       `json:",omitempty"`
+	TemplateType   TemplateType `json:",omitempty"`
+	LayoutTemplate string       `json:",omitempty"`
+	// Path of the template JSON in the archive
+	Path string
+}
+
+// ExportTemplates writes every template of the server, layouts included, to w
+// as a gzipped tar archive holding manifest.json and one JSON file per
+// template, as returned by GetTemplate
+func (client *Client) ExportTemplates(ctx context.Context, w io.Writer) (TemplateBackupManifest, error) {
+	manifest := TemplateBackupManifest{Version: TemplateBackupVersion, CreatedAt: time.Now().UTC()}
+
+	infos, err := client.GetAllTemplates(ctx, TemplatesFilter{TemplateType: TemplateTypeAll})
+	if err != nil {
+		return manifest, err
+	}
+
+	var templates []Template
+	for _, info := range infos {
+		template, err := client.GetTemplate(ctx, strconv.FormatInt(info.TemplateID, 10))
+		if err != nil {
+			return manifest, err
+		}
+		templates = append(templates, template)
+	}
+	sortTemplatesLayoutsFirst(templates)
+
+	files := map[string][]byte{}
+	for _, template := range templates {
+		name := template.Alias
+		if name == "" {
+			name = "id-" + strconv.FormatInt(template.TemplateID, 10)
+		}
+		entry := TemplateBackupEntry{
+			TemplateID:     template.TemplateID,
+			Name:           template.Name,
+			Alias:          template.Alias,
+			TemplateType:   template.TemplateType,
+			LayoutTemplate: template.LayoutTemplate,
+			Path:           path.Join("templates", name+".json"),
+		}
+		if manifest.ServerID == 0 {
+			manifest.ServerID = template.AssociatedServerID
+		}
+		if files[entry.Path], err = json.MarshalIndent(template, "", "  "); err != nil {
+			return manifest, err
+		}
+		manifest.Templates = append(manifest.Templates, entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	write := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0o644,
+			Size:    int64(len(data)),
+			ModTime: manifest.CreatedAt,
+		}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err = write(templateBackupManifest, data); err != nil {
+		return manifest, err
+	}
+	for _, entry := range manifest.Templates {
+		if err = write(entry.Path, files[entry.Path]); err != nil {
+			return manifest, err
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return manifest, err
+	}
+	return manifest, gz.Close()
+}
+
+// ReadTemplateBackup reads an archive written by ExportTemplates, returning
+// its manifest and templates in manifest order
+func ReadTemplateBackup(r io.Reader) (TemplateBackupManifest, []Template, error) {
+	manifest := TemplateBackupManifest{}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, nil, err
+	}
+	defer func() {
+		_ = gz.Close()
+	}()
+
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return manifest, nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if files[header.Name], err = io.ReadAll(tr); err != nil {
+			return manifest, nil, err
+		}
+	}
+
+	data, ok := files[templateBackupManifest]
+	if !ok {
+		return manifest, nil, errors.New("postmark: template backup has no manifest")
+	}
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return manifest, nil, err
+	}
+	if manifest.Version > TemplateBackupVersion {
+		return manifest, nil, fmt.Errorf("postmark: unsupported template backup version %d", manifest.Version)
+	}
+
+	templates := make([]Template, 0, len(manifest.Templates))
+	for _, entry := range manifest.Templates {
+		data, ok := files[entry.Path]
+		if !ok {
+			return manifest, nil, fmt.Errorf("postmark: template backup is missing %s", entry.Path)
+		}
+		template := Template{}
+		if err = json.Unmarshal(data, &template); err != nil {
+			return manifest, nil, fmt.Errorf("%s: %w", entry.Path, err)
+		}
+		templates = append(templates, template)
+	}
+	return manifest, templates, nil
+}
+
+// TemplateConflictPolicy decides what ImportTemplates does with a template whose
+// alias already exists on the server
+type TemplateConflictPolicy string
+
+const (
+	// TemplateConflictFail imports nothing when any alias exists, the default
+	TemplateConflictFail TemplateConflictPolicy = "fail"
+	// TemplateConflictSkip keeps the existing template
+	TemplateConflictSkip TemplateConflictPolicy = "skip"
+	// TemplateConflictOverwrite replaces the existing template with the backup
+	TemplateConflictOverwrite TemplateConflictPolicy = "overwrite"
+	// TemplateConflictRename imports the template under a new alias, updating
+	// the LayoutTemplate of the templates using it
+	TemplateConflictRename TemplateConflictPolicy = "rename"
+)
+
+// TemplateImportOptions configures ImportTemplates
+type TemplateImportOptions struct {
+	// OnConflict: what to do when an alias exists, TemplateConflictFail by default
+	OnConflict TemplateConflictPolicy
+	// RenameSuffix is appended to renamed aliases, "-restored" by default. A number
+	// is added when the suffixed alias exists as well.
+	RenameSuffix string
+	// DryRun reports what would be done without changing the server
+	DryRun bool
+}
+
+// TemplateImportConflict is a template of the backup whose alias exists on the server
+type TemplateImportConflict struct {
+	// Alias of the template in the backup
+	Alias string
+	// ExistingID: ID of the template using the alias on the server
+	ExistingID int64
+	// Resolution: the TemplateConflictPolicy applied, or why it could not be
+	Resolution string
+	// NewAlias: the alias used when the template was renamed
+	NewAlias string `json:",omitempty"`
+}
+
+// TemplateImportResult reports what ImportTemplates did
+type TemplateImportResult struct {
+	Created   []TemplateInfo
+	Updated   []TemplateInfo
+	Skipped   []string
+	Conflicts []TemplateImportConflict
+	// Aliases maps the aliases of the backup to the aliases used on the server,
+	// for renamed templates
+	Aliases map[string]string
+}
+
+// ImportTemplates restores an archive written by ExportTemplates into the
+// server of client, which may differ from the exported one. Layouts are
+// restored first, and the LayoutTemplate of standard templates is remapped
+// when a layout is renamed. Templates without an alias are always created.
+func (client *Client) ImportTemplates(ctx context.Context, r io.Reader, opts TemplateImportOptions) (TemplateImportResult, error) {
+	result := TemplateImportResult{Aliases: map[string]string{}}
+	if opts.OnConflict == "" {
+		opts.OnConflict = TemplateConflictFail
+	}
+	if opts.RenameSuffix == "" {
+		opts.RenameSuffix = "-restored"
+	}
+
+	_, templates, err := ReadTemplateBackup(r)
+	if err != nil {
+		return result, err
+	}
+	sortTemplatesLayoutsFirst(templates)
+
+	infos, err := client.GetAllTemplates(ctx, TemplatesFilter{TemplateType: TemplateTypeAll})
+	if err != nil {
+		return result, err
+	}
+	existing := map[string]TemplateInfo{}
+	for _, info := range infos {
+		if info.Alias != "" {
+			existing[strings.ToLower(info.Alias)] = info
+		}
+	}
+
+	// Resolve every conflict before writing anything
+	type importAction struct {
+		template Template
+		update   string
+	}
+	var actions []importAction
+	for _, template := range templates {
+		template.TemplateID = 0
+		template.AssociatedServerID = 0
+
+		current, ok := existing[strings.ToLower(template.Alias)]
+		if template.Alias == "" || !ok {
+			if template.Alias != "" {
+				existing[strings.ToLower(template.Alias)] = TemplateInfo{Alias: template.Alias}
+			}
+			actions = append(actions, importAction{template: template})
+			continue
+		}
+
+		conflict := TemplateImportConflict{Alias: template.Alias, ExistingID: current.TemplateID, Resolution: string(opts.OnConflict)}
+		switch opts.OnConflict {
+		case TemplateConflictSkip:
+			result.Skipped = append(result.Skipped, template.Alias)
+		case TemplateConflictOverwrite:
+			existingType := current.TemplateType
+			if existingType == "" {
+				existingType = TemplateTypeStandard
+			}
+			if template.TemplateType != "" && template.TemplateType != existingType {
+				conflict.Resolution = fmt.Sprintf("skipped, existing template is a %s", existingType)
+				result.Skipped = append(result.Skipped, template.Alias)
+				break
+			}
+			actions = append(actions, importAction{template: template, update: template.Alias})
+		case TemplateConflictRename:
+			alias := template.Alias + opts.RenameSuffix
+			for n := 2; ; n++ {
+				if _, taken := existing[strings.ToLower(alias)]; !taken {
+					break
+				}
+				alias = template.Alias + opts.RenameSuffix + "-" + strconv.Itoa(n)
+			}
+			existing[strings.ToLower(alias)] = TemplateInfo{Alias: alias}
+			result.Aliases[template.Alias] = alias
+			conflict.NewAlias = alias
+			template.Alias = alias
+			actions = append(actions, importAction{template: template})
+		}
+		result.Conflicts = append(result.Conflicts, conflict)
+	}
+
+	if opts.OnConflict == TemplateConflictFail && len(result.Conflicts) > 0 {
+		aliases := make([]string, 0, len(result.Conflicts))
+		for _, conflict := range result.Conflicts {
+			aliases = append(aliases, conflict.Alias)
+		}
+		return result, fmt.Errorf("%w: %s", ErrTemplateAliasConflict, strings.Join(aliases, ", "))
+	}
+
+	for _, action := range actions {
+		template := action.template
+		if alias, ok := result.Aliases[template.LayoutTemplate]; ok {
+			template.LayoutTemplate = alias
+		}
+		info := TemplateInfo{
+			Name:           template.Name,
+			Alias:          template.Alias,
+			Active:         template.Active,
+			TemplateType:   template.TemplateType,
+			LayoutTemplate: template.LayoutTemplate,
+		}
+
+		if action.update != "" {
+			if !opts.DryRun {
+				if info, err = client.EditTemplate(ctx, action.update, template); err != nil {
+					return result, fmt.Errorf("updating %s: %w", action.update, err)
+				}
+			}
+			result.Updated = append(result.Updated, info)
+			continue
+		}
+		if !opts.DryRun {
+			if info, err = client.CreateTemplate(ctx, template); err != nil {
+				return result, fmt.Errorf("creating %s: %w", template.Name, err)
+			}
+		}
+		result.Created = append(result.Created, info)
+	}
+	return result, nil
+}
+
+// sortTemplatesLayoutsFirst orders layouts before the standard templates using them
+func sortTemplatesLayoutsFirst(templates []Template) {
+	sort.SliceStable(templates, func(i, j int) bool {
+		return templates[i].TemplateType == TemplateTypeLayout && templates[j].TemplateType != TemplateTypeLayout
+	})
+}
@@ -0,0 +1,191 @@
+package postmark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLocalizedTemplateNotFound is returned when no alias of the fallback chain exists
+var ErrLocalizedTemplateNotFound = errors.New("postmark: localized template not found")
+
+// LocalizedTemplates selects the variant of a template for a locale. Variants are
+// templates whose alias is the base alias followed by the locale, such as
+// "welcome-de" or "welcome-de-at". A locale falls back to its parents and then
+// to DefaultLocale, so de-AT resolves to welcome-de-at, welcome-de, welcome-en
+// and finally the base alias itself. The aliases existing on the server are
+// cached, see Refresh.
+type LocalizedTemplates struct {
+	// Client used to list templates
+	Client *Client
+	// Sender used to send, Client by default
+	Sender Sender
+	// DefaultLocale ends every fallback chain, "en" by default
+	DefaultLocale string
+	// Separator between the base alias and the locale, "-" by default
+	Separator string
+	// TTL of the alias cache, 0 caches aliases until Refresh is called
+	TTL time.Duration
+
+	mu        sync.Mutex
+	aliases   map[string]string
+	fetchedAt time.Time
+}
+
+// NewLocalizedTemplates builds a LocalizedTemplates listing and sending with client
+func NewLocalizedTemplates(client *Client, defaultLocale string) *LocalizedTemplates {
+	return &LocalizedTemplates{Client: client, DefaultLocale: defaultLocale}
+}
+
+// MissingTranslation is a locale without its own variant of a base template
+type MissingTranslation struct {
+	// Base alias
+	Base string
+	// Locale lacking a variant
+	Locale string
+	// Fallback: the alias used instead, empty when there is none
+	Fallback string
+}
+
+// LocaleFallbacks returns the locales tried for locale, most specific first:
+// "de_AT" gives de-at, de and then defaultLocale
+func LocaleFallbacks(locale, defaultLocale string) []string {
+	var chain []string
+	add := func(l string) {
+		l = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(l), "_", "-"))
+		for l != "" {
+			seen := false
+			for _, c := range chain {
+				seen = seen || c == l
+			}
+			if !seen {
+				chain = append(chain, l)
+			}
+			i := strings.LastIndexByte(l, '-')
+			if i < 0 {
+				break
+			}
+			l = l[:i]
+		}
+	}
+	add(locale)
+	add(defaultLocale)
+	return chain
+}
+
+// Refresh reloads the aliases existing on the server
+func (l *LocalizedTemplates) Refresh(ctx context.Context) error {
+	infos, err := l.Client.GetAllTemplates(ctx, TemplatesFilter{})
+	if err != nil {
+		return err
+	}
+
+	aliases := make(map[string]string, len(infos))
+	for _, info := range infos {
+		if info.Alias != "" {
+			aliases[strings.ToLower(info.Alias)] = info.Alias
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.aliases = aliases
+	l.fetchedAt = time.Now()
+	return nil
+}
+
+// Resolve returns the alias of the most specific variant of base for locale
+func (l *LocalizedTemplates) Resolve(ctx context.Context, base, locale string) (string, error) {
+	aliases, err := l.cachedAliases(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, candidate := range l.candidates(base, locale) {
+		if alias, ok := aliases[strings.ToLower(candidate)]; ok {
+			return alias, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s for locale %q", ErrLocalizedTemplateNotFound, base, locale)
+}
+
+// SendTemplatedEmail sends email with the variant of base resolved for locale
+func (l *LocalizedTemplates) SendTemplatedEmail(ctx context.Context, base, locale string, email TemplatedEmail) (EmailResponse, error) {
+	alias, err := l.Resolve(ctx, base, locale)
+	if err != nil {
+		return EmailResponse{}, err
+	}
+	email.TemplateID = 0
+	email.TemplateAlias = alias
+
+	sender := l.Sender
+	if sender == nil {
+		sender = l.Client
+	}
+	return sender.SendTemplatedEmail(ctx, email)
+}
+
+// MissingTranslations lists, for each base alias, the locales without their own
+// variant, with the alias their fallback chain resolves to
+func (l *LocalizedTemplates) MissingTranslations(ctx context.Context, bases []string, locales []string) ([]MissingTranslation, error) {
+	aliases, err := l.cachedAliases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []MissingTranslation
+	for _, base := range bases {
+		for _, locale := range locales {
+			candidates := l.candidates(base, locale)
+			if _, ok := aliases[strings.ToLower(candidates[0])]; ok {
+				continue
+			}
+			m := MissingTranslation{Base: base, Locale: locale}
+			for _, candidate := range candidates[1:] {
+				if alias, ok := aliases[strings.ToLower(candidate)]; ok {
+					m.Fallback = alias
+					break
+				}
+			}
+			missing = append(missing, m)
+		}
+	}
+	return missing, nil
+}
+
+// candidates returns the aliases tried for base and locale, ending with base
+func (l *LocalizedTemplates) candidates(base, locale string) []string {
+	defaultLocale, separator := l.DefaultLocale, l.Separator
+	if defaultLocale == "" {
+		defaultLocale = "en"
+	}
+	if separator == "" {
+		separator = "-"
+	}
+
+	var candidates []string
+	for _, fallback := range LocaleFallbacks(locale, defaultLocale) {
+		candidates = append(candidates, base+separator+strings.ReplaceAll(fallback, "-", separator))
+	}
+	return append(candidates, base)
+}
+
+// cachedAliases returns the cached aliases, refreshing them when missing or expired
+func (l *LocalizedTemplates) cachedAliases(ctx context.Context) (map[string]string, error) {
+	l.mu.Lock()
+	aliases, fetchedAt := l.aliases, l.fetchedAt
+	l.mu.Unlock()
+
+	if aliases != nil && (l.TTL == 0 || time.Since(fetchedAt) < l.TTL) {
+		return aliases, nil
+	}
+	if err := l.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.aliases, nil
+}
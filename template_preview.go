@@ -0,0 +1,334 @@
+package postmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// layoutContentTag is where a layout includes the content of its templates
+var layoutContentTag = regexp.MustCompile(`\{\{\{\s*@content\s*\}\}\}`)
+
+// TemplatePreviewHandler is an http.Handler previewing templates in a browser.
+// It lists the templates of the server, or of a local directory when Dir is
+// set, and renders any of them through ValidateTemplate with a JSON model which
+// can be edited in the page. The subject, the HTML body at desktop and mobile
+// widths and the text body are shown side by side. Pages previewing a local
+// directory reload when its files change. Rendered HTML is shown in sandboxed
+// iframes, so that scripts of templates do not run on the origin of the handler.
+//
+// The handler uses relative links and can be mounted under a prefix with
+// http.StripPrefix, the prefix ending with a slash.
+type TemplatePreviewHandler struct {
+	// Client used to list, fetch and render templates
+	Client *Client
+	// Dir of local templates, see ReadTemplateDir. Server templates are
+	// previewed when empty. Templates use the local copy of their layout when
+	// Dir has one, and the layout of the server otherwise.
+	Dir string
+	// InlineCSS inlines <style> blocks into the rendered HTML
+	InlineCSS bool
+	// PollInterval between checks of Dir for changes, 1s by default
+	PollInterval time.Duration
+}
+
+// NewTemplatePreviewHandler builds a TemplatePreviewHandler for the templates
+// of dir, or of the server of client when dir is empty
+func NewTemplatePreviewHandler(client *Client, dir string) *TemplatePreviewHandler {
+	return &TemplatePreviewHandler{Client: client, Dir: dir, InlineCSS: true}
+}
+
+// ServeHTTP serves the index at /, previews at /template?id=<id or alias>&model=<json>
+// and reload notifications as server-sent events at /events
+func (h *TemplatePreviewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/", "":
+		h.serveIndex(w, r)
+	case "/template":
+		h.serveTemplate(w, r)
+	case "/events":
+		h.serveEvents(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+type previewTemplateLink struct {
+	ID           string
+	Name         string
+	TemplateType TemplateType
+}
+
+func (h *TemplatePreviewHandler) serveIndex(w http.ResponseWriter, r *http.Request) {
+	var links []previewTemplateLink
+	if h.Dir != "" {
+		dirs, err := readTemplateDirs(h.Dir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Local templates are identified by directory, as meta.json may set another alias
+		for _, d := range dirs {
+			links = append(links, previewTemplateLink{ID: filepath.Base(d.Path), Name: d.Template.Name, TemplateType: d.Template.TemplateType})
+		}
+	} else {
+		infos, err := h.Client.GetAllTemplates(r.Context(), TemplatesFilter{TemplateType: TemplateTypeAll})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		for _, info := range infos {
+			id := info.Alias
+			if id == "" {
+				id = strconv.FormatInt(info.TemplateID, 10)
+			}
+			links = append(links, previewTemplateLink{ID: id, Name: info.Name, TemplateType: info.TemplateType})
+		}
+	}
+	sort.SliceStable(links, func(i, j int) bool { return links[i].Name < links[j].Name })
+
+	h.render(w, previewIndexPage, map[string]interface{}{
+		"Templates":  links,
+		"LiveReload": h.Dir != "",
+	})
+}
+
+type previewPage struct {
+	ID          string
+	Name        string
+	Model       string
+	Subject     string
+	HTMLBody    string
+	TextBody    string
+	Errors      []string
+	LiveReload  bool
+	IsLayout    bool
+	Suggested   bool
+	RenderError string
+}
+
+func (h *TemplatePreviewHandler) serveTemplate(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Redirect(w, r, "./", http.StatusFound)
+		return
+	}
+	page := previewPage{ID: id, LiveReload: h.Dir != ""}
+
+	var t Template
+	var err error
+	if h.Dir != "" {
+		t, err = ReadTemplateFromDir(filepath.Join(h.Dir, filepath.Base(id)))
+		if err == nil {
+			t, err = h.withLocalLayout(t)
+		}
+	} else {
+		t, err = h.Client.GetTemplate(r.Context(), id)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	page.Name = t.Name
+	page.IsLayout = t.TemplateType == TemplateTypeLayout
+
+	body := validateTemplateBodyFor(t)
+	body.InlineCSSForHTMLTestRender = h.InlineCSS
+
+	page.Model = r.URL.Query().Get("model")
+	if page.Model == "" {
+		page.Model = h.sampleModel(id)
+	}
+	if page.Model == "" {
+		res, err := h.Client.ValidateTemplate(r.Context(), body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		data, _ := json.MarshalIndent(res.SuggestedTemplateModel, "", "  ")
+		page.Model = string(data)
+		page.Suggested = true
+	}
+
+	if err = json.Unmarshal([]byte(page.Model), &body.TestRenderModel); err != nil {
+		page.RenderError = "model: " + err.Error()
+		h.render(w, previewTemplatePage, page)
+		return
+	}
+
+	res, err := h.Client.ValidateTemplate(r.Context(), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	for _, d := range validationDiagnostics(id, res) {
+		page.Errors = append(page.Errors, d.String())
+	}
+	page.Subject = res.Subject.RenderedContent
+	page.HTMLBody = res.HTMLBody.RenderedContent
+	page.TextBody = res.TextBody.RenderedContent
+	h.render(w, previewTemplatePage, page)
+}
+
+// withLocalLayout wraps the bodies of a local template in its layout when the
+// layout is also in Dir, as ValidateTemplate only resolves layouts of the server
+func (h *TemplatePreviewHandler) withLocalLayout(t Template) (Template, error) {
+	if t.LayoutTemplate == "" {
+		return t, nil
+	}
+	dirs, err := readTemplateDirs(h.Dir)
+	if err != nil {
+		return t, err
+	}
+	for _, d := range dirs {
+		layout := d.Template
+		if layout.TemplateType != TemplateTypeLayout || layout.Alias != t.LayoutTemplate {
+			continue
+		}
+		// A layout part which is empty leaves the matching template part unwrapped
+		if layout.HTMLBody != "" {
+			t.HTMLBody = layoutContentTag.ReplaceAllLiteralString(layout.HTMLBody, t.HTMLBody)
+		}
+		if layout.TextBody != "" {
+			t.TextBody = layoutContentTag.ReplaceAllLiteralString(layout.TextBody, t.TextBody)
+		}
+		t.LayoutTemplate = ""
+		return t, nil
+	}
+	return t, nil
+}
+
+// sampleModel returns the first sample model of a local template, see TemplateSamplesDir
+func (h *TemplatePreviewHandler) sampleModel(id string) string {
+	if h.Dir == "" {
+		return ""
+	}
+	samples, _ := filepath.Glob(filepath.Join(h.Dir, filepath.Base(id), TemplateSamplesDir, "*.json"))
+	if len(samples) == 0 {
+		return ""
+	}
+	data, err := os.ReadFile(samples[0])
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// serveEvents sends a "reload" event whenever a file of Dir changes
+func (h *TemplatePreviewHandler) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if h.Dir == "" || !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	interval := h.PollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	version := h.dirVersion()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		if current := h.dirVersion(); current != version {
+			version = current
+			if _, err := fmt.Fprint(w, "data: reload\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// dirVersion summarizes the files of Dir, changing whenever one is added, removed or modified
+func (h *TemplatePreviewHandler) dirVersion() string {
+	var files int
+	var latest time.Time
+	_ = filepath.WalkDir(h.Dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		files++
+		if info, err := d.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return fmt.Sprintf("%d/%d", files, latest.UnixNano())
+}
+
+func (h *TemplatePreviewHandler) render(w http.ResponseWriter, page *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := page.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+const previewStyle = `<style>
+body { font-family: system-ui, sans-serif; margin: 0; padding: 1rem 1.5rem; background: #f5f5f7; color: #222; }
+a { color: #0a58ca; text-decoration: none; }
+ul { list-style: none; padding: 0; }
+li { padding: .3rem 0; }
+.type { color: #888; font-size: .8rem; margin-left: .5rem; }
+.errors { background: #fdecea; color: #a4262c; padding: .5rem 1rem; white-space: pre-wrap; }
+.subject { font-size: 1.2rem; margin: .5rem 0 1rem; }
+.panes { display: flex; gap: 1rem; align-items: flex-start; overflow-x: auto; }
+.pane h3 { font-size: .8rem; text-transform: uppercase; color: #888; margin: 0 0 .3rem; }
+iframe { border: 1px solid #ddd; background: #fff; height: 70vh; }
+pre { background: #fff; border: 1px solid #ddd; padding: .5rem; margin: 0; height: 70vh; width: 28rem; overflow: auto; white-space: pre-wrap; }
+textarea { width: 100%; height: 10rem; font-family: monospace; }
+</style>`
+
+const previewReload = `{{if .LiveReload}}<script>new EventSource("events").onmessage = function () { location.reload(); };</script>{{end}}`
+
+var previewIndexPage = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Templates</title>` + previewStyle + `</head>
+<body>
+<h1>Templates</h1>
+<ul>
+{{range .Templates}}<li><a href="template?id={{.ID}}">{{.Name}}</a><span class="type">{{.ID}} · {{.TemplateType}}</span></li>
+{{else}}<li>No templates.</li>
+{{end}}</ul>
+` + previewReload + `
+</body></html>`))
+
+var previewTemplatePage = template.Must(template.New("template").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Name}}</title>` + previewStyle + `</head>
+<body>
+<p><a href="./">← Templates</a></p>
+<h1>{{.Name}}</h1>
+{{if .RenderError}}<div class="errors">{{.RenderError}}</div>{{end}}
+{{if .Errors}}<div class="errors">{{range .Errors}}{{.}}
+{{end}}</div>{{end}}
+{{if not .IsLayout}}<div class="subject"><strong>Subject:</strong> {{.Subject}}</div>{{end}}
+<div class="panes">
+<div class="pane"><h3>Desktop</h3><iframe width="800" sandbox="allow-popups allow-popups-to-escape-sandbox" srcdoc="{{.HTMLBody}}"></iframe></div>
+<div class="pane"><h3>Mobile</h3><iframe width="375" sandbox="allow-popups allow-popups-to-escape-sandbox" srcdoc="{{.HTMLBody}}"></iframe></div>
+<div class="pane"><h3>Text</h3><pre>{{.TextBody}}</pre></div>
+</div>
+<form method="get" action="template">
+<input type="hidden" name="id" value="{{.ID}}">
+<h3>Model{{if .Suggested}} (suggested){{end}}</h3>
+<textarea name="model">{{.Model}}</textarea>
+<p><button type="submit">Render</button></p>
+</form>
+` + previewReload + `
+</body></html>`))
@@ -0,0 +1,215 @@
+package postmark
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// TestingT is the subset of testing.TB used by TemplateSnapshot.Test
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// SnapshotDiff is a rendered file which differs from its golden file
+type SnapshotDiff struct {
+	// Golden file path
+	File string
+	// Diff is a unified diff from the golden file to the rendered output
+	Diff string
+}
+
+// TemplateSnapshot renders the templates of a directory, see ReadTemplateDir,
+// with each of their sample models, see TemplateSamplesDir, and compares the
+// output with golden files stored as Golden/<alias>/<sample>/subject.txt,
+// content.html and content.txt. Templates without samples are rendered with
+// their suggested model, under the sample name "suggested". Layouts are only
+// rendered through the templates using them.
+//
+// A typical test wires Update to a flag:
+//
+//	var update = flag.Bool("update", false, "update golden files")
+//
+//	func TestTemplates(t *testing.T) {
+//		snapshot := postmark.TemplateSnapshot{Templates: "templates", Golden: "testdata/golden", Update: *update}
+//		snapshot.Test(t)
+//	}
+type TemplateSnapshot struct {
+	// Templates directory
+	Templates string
+	// Golden directory
+	Golden string
+	// Update rewrites the golden files instead of comparing them
+	Update bool
+	// Client renders with ValidateTemplate when set, using the layouts stored on
+	// the server. Templates are rendered locally with TemplateRenderer otherwise.
+	Client *Client
+	// InlineCSS inlines <style> blocks into the rendered HTML
+	InlineCSS bool
+}
+
+// Check renders every template and returns the differences with the golden files.
+// Missing golden files differ from any output. With Update set the golden files
+// are written and the differences they had are returned.
+func (s TemplateSnapshot) Check(ctx context.Context) ([]SnapshotDiff, error) {
+	dirs, err := readTemplateDirs(s.Templates)
+	if err != nil {
+		return nil, err
+	}
+
+	renderer := &TemplateRenderer{Layouts: map[string]Template{}, InlineCSS: s.InlineCSS}
+	for _, d := range dirs {
+		if d.Template.TemplateType == TemplateTypeLayout {
+			renderer.Layouts[d.Template.Alias] = d.Template
+		}
+	}
+
+	var diffs []SnapshotDiff
+	for _, d := range dirs {
+		template := d.Template
+		if template.TemplateType == TemplateTypeLayout {
+			continue
+		}
+
+		samples, err := s.samples(ctx, renderer, template, d.Path)
+		if err != nil {
+			return diffs, err
+		}
+		names := make([]string, 0, len(samples))
+		for name := range samples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			rendered, err := s.render(ctx, renderer, template, samples[name])
+			if err != nil {
+				return diffs, fmt.Errorf("rendering %s with %s: %w", template.Alias, name, err)
+			}
+
+			dir := filepath.Join(s.Golden, template.Alias, name)
+			for _, part := range [][2]string{
+				{TemplateSubjectFile, rendered.Subject},
+				{TemplateHTMLFile, rendered.HTMLBody},
+				{TemplateTextFile, rendered.TextBody},
+			} {
+				path, content := filepath.Join(dir, part[0]), part[1]
+				golden, err := os.ReadFile(path)
+				if err != nil && !errors.Is(err, os.ErrNotExist) {
+					return diffs, err
+				}
+				if err == nil && string(golden) == content {
+					continue
+				}
+
+				diffs = append(diffs, SnapshotDiff{
+					File: path,
+					Diff: unifiedDiff(path, path+" (rendered)", string(golden), content),
+				})
+				if s.Update {
+					if err = os.MkdirAll(dir, 0o755); err != nil {
+						return diffs, err
+					}
+					if err = os.WriteFile(path, []byte(content), 0o644); err != nil {
+						return diffs, err
+					}
+				}
+			}
+		}
+	}
+	return diffs, nil
+}
+
+// Test runs Check, reporting each difference as a test error. Golden files
+// are rewritten instead when Update is set.
+func (s TemplateSnapshot) Test(t TestingT) {
+	t.Helper()
+
+	diffs, err := s.Check(context.Background())
+	if err != nil {
+		t.Fatalf("template snapshot: %v", err)
+	}
+	if s.Update {
+		return
+	}
+	for _, diff := range diffs {
+		t.Errorf("%s does not match the rendered template:\n%s", diff.File, diff.Diff)
+	}
+}
+
+// samples reads the sample models of the template read from dir by name,
+// falling back to its suggested model
+func (s TemplateSnapshot) samples(ctx context.Context, renderer *TemplateRenderer, template Template, dir string) (map[string]map[string]interface{}, error) {
+	samples := map[string]map[string]interface{}{}
+
+	files, err := filepath.Glob(filepath.Join(dir, TemplateSamplesDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		model := map[string]interface{}{}
+		if err = json.Unmarshal(data, &model); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		samples[strings.TrimSuffix(filepath.Base(file), ".json")] = model
+	}
+	if len(samples) > 0 {
+		return samples, nil
+	}
+
+	var suggested map[string]interface{}
+	if s.Client != nil {
+		res, err := s.Client.ValidateTemplate(ctx, validateTemplateBodyFor(template))
+		if err != nil {
+			return nil, err
+		}
+		suggested = res.SuggestedTemplateModel
+	} else {
+		res, err := renderer.Render(template, nil)
+		if err != nil {
+			return nil, err
+		}
+		suggested = res.SuggestedTemplateModel
+	}
+	samples["suggested"] = suggested
+	return samples, nil
+}
+
+// render renders a template with ValidateTemplate or the local renderer
+func (s TemplateSnapshot) render(ctx context.Context, renderer *TemplateRenderer, template Template, model map[string]interface{}) (RenderedTemplate, error) {
+	if s.Client == nil {
+		return renderer.Render(template, model)
+	}
+
+	body := validateTemplateBodyFor(template)
+	body.TestRenderModel = model
+	body.InlineCSSForHTMLTestRender = s.InlineCSS
+	res, err := s.Client.ValidateTemplate(ctx, body)
+	if err != nil {
+		return RenderedTemplate{}, err
+	}
+	if !res.AllContentIsValid {
+		var messages []string
+		for _, d := range validationDiagnostics(template.Alias, res) {
+			messages = append(messages, d.String())
+		}
+		return RenderedTemplate{}, errors.New(strings.Join(messages, "; "))
+	}
+	return RenderedTemplate{
+		Subject:                res.Subject.RenderedContent,
+		HTMLBody:               res.HTMLBody.RenderedContent,
+		TextBody:               res.TextBody.RenderedContent,
+		SuggestedTemplateModel: res.SuggestedTemplateModel,
+	}, nil
+}
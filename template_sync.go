@@ -0,0 +1,458 @@
+package postmark
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Files making up a template directory
+const (
+	TemplateSubjectFile = "subject.txt"
+	TemplateHTMLFile    = "content.html"
+	TemplateTextFile    = "content.txt"
+	TemplateMetaFile    = "meta.json"
+)
+
+// templateMeta is the content of meta.json
+type templateMeta struct {
+	Name           string
+	Alias          string
+	TemplateType   TemplateType `json:",omitempty"`
+	LayoutTemplate string       `json:",omitempty"`
+}
+
+// ReadTemplateDir reads every template stored in the subdirectories of dir. Each
+// template lives in its own directory holding subject.txt, content.html,
+// content.txt and meta.json. The alias defaults to the directory name.
+func ReadTemplateDir(dir string) ([]Template, error) {
+	dirs, err := readTemplateDirs(dir)
+	if err != nil {
+		return nil, err
+	}
+	templates := make([]Template, 0, len(dirs))
+	for _, d := range dirs {
+		templates = append(templates, d.Template)
+	}
+	return templates, nil
+}
+
+// templateDir is a template read from a directory, whose name may differ from
+// the alias set in its meta.json
+type templateDir struct {
+	Path     string
+	Template Template
+}
+
+// readTemplateDirs reads the templates of dir along with their directory
+func readTemplateDirs(dir string) ([]templateDir, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []templateDir
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if _, err = os.Stat(filepath.Join(path, TemplateMetaFile)); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		template, err := ReadTemplateFromDir(path)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, templateDir{Path: path, Template: template})
+	}
+	return dirs, nil
+}
+
+// ReadTemplateFromDir reads a single template directory, see ReadTemplateDir
+func ReadTemplateFromDir(path string) (Template, error) {
+	template := Template{}
+
+	data, err := os.ReadFile(filepath.Join(path, TemplateMetaFile))
+	if err != nil {
+		return template, err
+	}
+	meta := templateMeta{}
+	if err = json.Unmarshal(data, &meta); err != nil {
+		return template, fmt.Errorf("%s: %w", filepath.Join(path, TemplateMetaFile), err)
+	}
+
+	template.Name = meta.Name
+	template.Alias = meta.Alias
+	template.TemplateType = meta.TemplateType
+	template.LayoutTemplate = meta.LayoutTemplate
+	if template.Alias == "" {
+		template.Alias = filepath.Base(path)
+	}
+	if template.Name == "" {
+		template.Name = template.Alias
+	}
+
+	for file, dst := range map[string]*string{
+		TemplateSubjectFile: &template.Subject,
+		TemplateHTMLFile:    &template.HTMLBody,
+		TemplateTextFile:    &template.TextBody,
+	} {
+		data, err := os.ReadFile(filepath.Join(path, file))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return template, err
+		}
+		*dst = string(data)
+	}
+	return template, nil
+}
+
+// WriteTemplateToDir writes template into dir/<alias>, see ReadTemplateDir
+func WriteTemplateToDir(dir string, template Template) error {
+	if template.Alias == "" {
+		return fmt.Errorf("postmark: template %q has no alias", template.Name)
+	}
+	path := filepath.Join(dir, template.Alias)
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return err
+	}
+
+	meta, err := json.MarshalIndent(templateMeta{
+		Name:           template.Name,
+		Alias:          template.Alias,
+		TemplateType:   template.TemplateType,
+		LayoutTemplate: template.LayoutTemplate,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	files := map[string]string{
+		TemplateMetaFile: string(meta) + "\n",
+		TemplateHTMLFile: template.HTMLBody,
+		TemplateTextFile: template.TextBody,
+	}
+	if template.TemplateType != TemplateTypeLayout {
+		files[TemplateSubjectFile] = template.Subject
+	}
+	for file, content := range files {
+		if err = os.WriteFile(filepath.Join(path, file), []byte(content), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TemplateSyncAction is what a sync does to a remote template
+type TemplateSyncAction string
+
+const (
+	// TemplateSyncCreate creates a template missing on the server
+	TemplateSyncCreate TemplateSyncAction = "create"
+	// TemplateSyncUpdate edits a template which differs from the local copy
+	TemplateSyncUpdate TemplateSyncAction = "update"
+	// TemplateSyncDelete deletes a template missing locally
+	TemplateSyncDelete TemplateSyncAction = "delete"
+)
+
+// TemplateSyncChange is a single change of a TemplateSyncPlan
+type TemplateSyncChange struct {
+	// Action to perform
+	Action TemplateSyncAction
+	// Alias of the template
+	Alias string
+	// Local template, nil for deletions
+	Local *Template
+	// Remote template, nil for creations
+	Remote *Template
+	// Fields which differ, for updates
+	Fields []string
+	// Diff is a unified diff from the remote to the local template
+	Diff string
+}
+
+// TemplateSyncPlan lists the changes a push would make to the server
+type TemplateSyncPlan struct {
+	Changes []TemplateSyncChange
+}
+
+// String formats the plan for review, with a diff for each change
+func (plan TemplateSyncPlan) String() string {
+	if len(plan.Changes) == 0 {
+		return "No changes.\n"
+	}
+
+	var sb strings.Builder
+	for _, change := range plan.Changes {
+		switch change.Action {
+		case TemplateSyncCreate:
+			fmt.Fprintf(&sb, "+ create %s\n", change.Alias)
+		case TemplateSyncUpdate:
+			fmt.Fprintf(&sb, "~ update %s (%s)\n", change.Alias, strings.Join(change.Fields, ", "))
+		case TemplateSyncDelete:
+			fmt.Fprintf(&sb, "- delete %s\n", change.Alias)
+		}
+		sb.WriteString(change.Diff)
+	}
+	return sb.String()
+}
+
+// TemplateValidationFailedError is returned by TemplateSync.Apply when changed
+// templates do not pass ValidateTemplate. Nothing is written in that case.
+type TemplateValidationFailedError struct {
+	// Results by template alias
+	Results map[string]ValidateTemplateResponse
+}
+
+// Error lists the invalid templates
+func (err TemplateValidationFailedError) Error() string {
+	aliases := make([]string, 0, len(err.Results))
+	for alias := range err.Results {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return "postmark: invalid templates: " + strings.Join(aliases, ", ")
+}
+
+// TemplateSync synchronizes the templates of a server with a local directory,
+// matching templates by alias. Use Pull to download templates, then Plan and
+// Apply to push local changes back.
+type TemplateSync struct {
+	// Client of the server to synchronize
+	Client *Client
+	// Dir holds one subdirectory per template, see ReadTemplateDir
+	Dir string
+	// Delete removes remote templates which are not present locally
+	Delete bool
+}
+
+// Pull writes every template of the server having an alias into Dir. Templates
+// without an alias cannot be matched and are returned as skipped.
+func (s *TemplateSync) Pull(ctx context.Context) (pulled []Template, skipped []TemplateInfo, err error) {
+	infos, err := s.Client.GetAllTemplates(ctx, TemplatesFilter{TemplateType: TemplateTypeAll})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, info := range infos {
+		if info.Alias == "" {
+			skipped = append(skipped, info)
+			continue
+		}
+		template, err := s.Client.GetTemplate(ctx, info.Alias)
+		if err != nil {
+			return pulled, skipped, err
+		}
+		if err = WriteTemplateToDir(s.Dir, template); err != nil {
+			return pulled, skipped, err
+		}
+		pulled = append(pulled, template)
+	}
+	return pulled, skipped, nil
+}
+
+// Plan compares the local templates with the server and returns the changes a
+// push would make. Layouts are created before and deleted after the templates using them.
+func (s *TemplateSync) Plan(ctx context.Context) (TemplateSyncPlan, error) {
+	plan := TemplateSyncPlan{}
+
+	local, err := ReadTemplateDir(s.Dir)
+	if err != nil {
+		return plan, err
+	}
+	infos, err := s.Client.GetAllTemplates(ctx, TemplatesFilter{TemplateType: TemplateTypeAll})
+	if err != nil {
+		return plan, err
+	}
+
+	remoteAliases := map[string]bool{}
+	for _, info := range infos {
+		if info.Alias != "" {
+			remoteAliases[info.Alias] = true
+		}
+	}
+
+	localAliases := map[string]bool{}
+	for i := range local {
+		l := local[i]
+		localAliases[l.Alias] = true
+		if !remoteAliases[l.Alias] {
+			plan.Changes = append(plan.Changes, TemplateSyncChange{
+				Action: TemplateSyncCreate,
+				Alias:  l.Alias,
+				Local:  &l,
+				Diff:   templateDiff(l.Alias, Template{}, l),
+			})
+			continue
+		}
+
+		remote, err := s.Client.GetTemplate(ctx, l.Alias)
+		if err != nil {
+			return plan, err
+		}
+		if fields := templateChangedFields(remote, l); len(fields) > 0 {
+			plan.Changes = append(plan.Changes, TemplateSyncChange{
+				Action: TemplateSyncUpdate,
+				Alias:  l.Alias,
+				Local:  &l,
+				Remote: &remote,
+				Fields: fields,
+				Diff:   templateDiff(l.Alias, remote, l),
+			})
+		}
+	}
+
+	if s.Delete {
+		for _, info := range infos {
+			if info.Alias == "" || localAliases[info.Alias] {
+				continue
+			}
+			remote := Template{TemplateID: info.TemplateID, Name: info.Name, Alias: info.Alias, TemplateType: info.TemplateType}
+			plan.Changes = append(plan.Changes, TemplateSyncChange{
+				Action: TemplateSyncDelete,
+				Alias:  info.Alias,
+				Remote: &remote,
+			})
+		}
+	}
+
+	sort.SliceStable(plan.Changes, func(i, j int) bool {
+		return templateSyncRank(plan.Changes[i]) < templateSyncRank(plan.Changes[j])
+	})
+	return plan, nil
+}
+
+// Apply validates every created or updated template with ValidateTemplate, and
+// applies the plan only if all of them are valid. Standard templates using a
+// layout created by the plan are validated without it, since the server does
+// not know the layout yet; the layout is validated on its own.
+func (s *TemplateSync) Apply(ctx context.Context, plan TemplateSyncPlan) error {
+	createdLayouts := map[string]bool{}
+	for _, change := range plan.Changes {
+		if change.Action == TemplateSyncCreate && change.Local.TemplateType == TemplateTypeLayout {
+			createdLayouts[change.Alias] = true
+		}
+	}
+
+	failed := TemplateValidationFailedError{Results: map[string]ValidateTemplateResponse{}}
+	for _, change := range plan.Changes {
+		if change.Local == nil {
+			continue
+		}
+		body := validateTemplateBodyFor(*change.Local)
+		if createdLayouts[body.LayoutTemplate] {
+			body.LayoutTemplate = ""
+		}
+		res, err := s.Client.ValidateTemplate(ctx, body)
+		if err != nil {
+			return fmt.Errorf("validating %s: %w", change.Alias, err)
+		}
+		if !res.AllContentIsValid {
+			failed.Results[change.Alias] = res
+		}
+	}
+	if len(failed.Results) > 0 {
+		return failed
+	}
+
+	for _, change := range plan.Changes {
+		var err error
+		switch change.Action {
+		case TemplateSyncCreate:
+			_, err = s.Client.CreateTemplate(ctx, *change.Local)
+		case TemplateSyncUpdate:
+			_, err = s.Client.EditTemplate(ctx, change.Alias, *change.Local)
+		case TemplateSyncDelete:
+			err = s.Client.DeleteTemplate(ctx, change.Alias)
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", change.Action, change.Alias, err)
+		}
+	}
+	return nil
+}
+
+// validateTemplateBodyFor builds the ValidateTemplate request for a template
+func validateTemplateBodyFor(template Template) ValidateTemplateBody {
+	return ValidateTemplateBody{
+		Subject:        template.Subject,
+		HTMLBody:       template.HTMLBody,
+		TextBody:       template.TextBody,
+		TemplateType:   template.TemplateType,
+		LayoutTemplate: template.LayoutTemplate,
+	}
+}
+
+// templateSyncRank orders changes: layouts are created and updated first, and
+// deleted last, so standard templates never reference a missing layout
+func templateSyncRank(change TemplateSyncChange) int {
+	isLayout := (change.Local != nil && change.Local.TemplateType == TemplateTypeLayout) ||
+		(change.Remote != nil && change.Remote.TemplateType == TemplateTypeLayout)
+	switch {
+	case change.Action != TemplateSyncDelete && isLayout:
+		return 0
+	case change.Action != TemplateSyncDelete:
+		return 1
+	case !isLayout:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// templateParts returns the comparable parts of a template, keyed by file name
+func templateParts(template Template) [][2]string {
+	templateType := template.TemplateType
+	if templateType == "" {
+		templateType = TemplateTypeStandard
+	}
+	return [][2]string{
+		{"Name", template.Name},
+		{"TemplateType", string(templateType)},
+		{"LayoutTemplate", template.LayoutTemplate},
+		{"Subject", template.Subject},
+		{"HtmlBody", template.HTMLBody},
+		{"TextBody", template.TextBody},
+	}
+}
+
+var templatePartFiles = map[string]string{
+	"Subject":  TemplateSubjectFile,
+	"HtmlBody": TemplateHTMLFile,
+	"TextBody": TemplateTextFile,
+}
+
+// templateChangedFields lists the fields which differ between two templates
+func templateChangedFields(a, b Template) []string {
+	partsA, partsB := templateParts(a), templateParts(b)
+	var fields []string
+	for i := range partsA {
+		if partsA[i][1] != partsB[i][1] {
+			fields = append(fields, partsA[i][0])
+		}
+	}
+	return fields
+}
+
+// templateDiff returns a unified diff of each changed part of two templates
+func templateDiff(alias string, remote, local Template) string {
+	partsA, partsB := templateParts(remote), templateParts(local)
+	var sb strings.Builder
+	for i := range partsA {
+		name := partsA[i][0]
+		file, ok := templatePartFiles[name]
+		if !ok {
+			file = TemplateMetaFile + " " + name
+		}
+		sb.WriteString(unifiedDiff("remote/"+alias+"/"+file, "local/"+alias+"/"+file, partsA[i][1], partsB[i][1]))
+	}
+	return sb.String()
+}
@@ -0,0 +1,324 @@
+package postmark
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// TemplateSamplesDir is the directory next to a template's files holding sample
+// models, one JSON object per file, which the template is rendered with
+const TemplateSamplesDir = "samples"
+
+// TemplateDiagnostic is a problem found in a template, at a position of one of its files
+type TemplateDiagnostic struct {
+	// File containing the problem
+	File string
+	// Line and Column are 1-based, 0 when unknown
+	Line   int
+	Column int
+	// Message describes the problem
+	Message string
+	// Warning is set for problems which do not prevent sending, such as a
+	// variable missing from a sample model
+	Warning bool
+}
+
+// String formats the diagnostic like a compiler, file:line:col: message
+func (d TemplateDiagnostic) String() string {
+	var sb strings.Builder
+	sb.WriteString(d.File)
+	if d.Line > 0 {
+		fmt.Fprintf(&sb, ":%d", d.Line)
+		if d.Column > 0 {
+			fmt.Fprintf(&sb, ":%d", d.Column)
+		}
+	}
+	sb.WriteString(": ")
+	if d.Warning {
+		sb.WriteString("warning: ")
+	}
+	sb.WriteString(d.Message)
+	return sb.String()
+}
+
+// TemplateReport is the result of validating template directories
+type TemplateReport struct {
+	// Templates is the number of templates validated
+	Templates int
+	// Samples is the number of sample models rendered
+	Samples int
+	// Diagnostics sorted by file and position
+	Diagnostics []TemplateDiagnostic
+}
+
+// Errors returns the number of diagnostics which are not warnings
+func (r TemplateReport) Errors() int {
+	n := 0
+	for _, d := range r.Diagnostics {
+		if !d.Warning {
+			n++
+		}
+	}
+	return n
+}
+
+// Failed reports whether the report should fail a CI run, counting warnings as
+// errors when strict is set
+func (r TemplateReport) Failed(strict bool) bool {
+	if strict {
+		return len(r.Diagnostics) > 0
+	}
+	return r.Errors() > 0
+}
+
+// String lists the diagnostics one per line, followed by a summary
+func (r TemplateReport) String() string {
+	var sb strings.Builder
+	for _, d := range r.Diagnostics {
+		sb.WriteString(d.String())
+		sb.WriteByte('\n')
+	}
+	errs := r.Errors()
+	fmt.Fprintf(&sb, "%d templates, %d samples: %d errors, %d warnings\n",
+		r.Templates, r.Samples, errs, len(r.Diagnostics)-errs)
+	return sb.String()
+}
+
+// TemplateValidator validates template directories, see ReadTemplateDir, with
+// ValidateTemplate and renders them with the sample models stored in their
+// TemplateSamplesDir
+type TemplateValidator struct {
+	// Client used to call ValidateTemplate
+	Client *Client
+	// InlineCSS is passed to ValidateTemplate when rendering samples
+	InlineCSS bool
+}
+
+// Validate validates the template at path, or every template below path when
+// it is not a template directory itself
+func (v *TemplateValidator) Validate(ctx context.Context, path string) (TemplateReport, error) {
+	report := TemplateReport{}
+
+	paths := []string{path}
+	if _, err := os.Stat(filepath.Join(path, TemplateMetaFile)); errors.Is(err, os.ErrNotExist) {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return report, err
+		}
+		paths = paths[:0]
+		for _, entry := range entries {
+			sub := filepath.Join(path, entry.Name())
+			if _, err = os.Stat(filepath.Join(sub, TemplateMetaFile)); entry.IsDir() && err == nil {
+				paths = append(paths, sub)
+			}
+		}
+	}
+
+	for _, p := range paths {
+		if err := v.validateTemplate(ctx, p, &report); err != nil {
+			return report, err
+		}
+	}
+
+	sort.SliceStable(report.Diagnostics, func(i, j int) bool {
+		a, b := report.Diagnostics[i], report.Diagnostics[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return report, nil
+}
+
+func (v *TemplateValidator) validateTemplate(ctx context.Context, path string, report *TemplateReport) error {
+	template, err := ReadTemplateFromDir(path)
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			report.Templates++
+			report.Diagnostics = append(report.Diagnostics, jsonDiagnostic(filepath.Join(path, TemplateMetaFile), syntaxErr))
+			return nil
+		}
+		return err
+	}
+	report.Templates++
+
+	body := validateTemplateBodyFor(template)
+	res, err := v.Client.ValidateTemplate(ctx, body)
+	if err != nil {
+		return fmt.Errorf("validating %s: %w", path, err)
+	}
+	report.Diagnostics = append(report.Diagnostics, validationDiagnostics(path, res)...)
+	if !res.AllContentIsValid {
+		return nil
+	}
+
+	samples, err := filepath.Glob(filepath.Join(path, TemplateSamplesDir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, sample := range samples {
+		report.Samples++
+
+		data, err := os.ReadFile(sample)
+		if err != nil {
+			return err
+		}
+		model := map[string]interface{}{}
+		if err = json.Unmarshal(data, &model); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				report.Diagnostics = append(report.Diagnostics, jsonDiagnostic(sample, syntaxErr))
+				continue
+			}
+			report.Diagnostics = append(report.Diagnostics, TemplateDiagnostic{File: sample, Message: err.Error()})
+			continue
+		}
+
+		body.TestRenderModel = model
+		body.InlineCSSForHTMLTestRender = v.InlineCSS
+		res, err := v.Client.ValidateTemplate(ctx, body)
+		if err != nil {
+			return fmt.Errorf("rendering %s: %w", sample, err)
+		}
+		for _, d := range validationDiagnostics(path, res) {
+			d.Message += " (sample " + filepath.Base(sample) + ")"
+			report.Diagnostics = append(report.Diagnostics, d)
+		}
+
+		var used []string
+		suggestedPaths(res.SuggestedTemplateModel, "", &used)
+		sort.Strings(used)
+		for _, variable := range used {
+			if modelValueHasPath(model, variable) {
+				continue
+			}
+			d := locateVariable(path, template, variable)
+			d.Message = fmt.Sprintf("variable %s is missing from sample %s", variable, filepath.Base(sample))
+			d.Warning = true
+			report.Diagnostics = append(report.Diagnostics, d)
+		}
+	}
+	return nil
+}
+
+// validationDiagnostics converts the errors of a ValidateTemplate response into
+// diagnostics pointing into the template files
+func validationDiagnostics(path string, res ValidateTemplateResponse) []TemplateDiagnostic {
+	var diagnostics []TemplateDiagnostic
+	for _, part := range []struct {
+		file       string
+		validation Validation
+	}{
+		{TemplateSubjectFile, res.Subject},
+		{TemplateHTMLFile, res.HTMLBody},
+		{TemplateTextFile, res.TextBody},
+	} {
+		for _, e := range part.validation.ValidationErrors {
+			diagnostics = append(diagnostics, TemplateDiagnostic{
+				File:    filepath.Join(path, part.file),
+				Line:    e.Line,
+				Column:  e.CharacterPosition,
+				Message: e.Message,
+			})
+		}
+	}
+	if !res.AllContentIsValid && len(diagnostics) == 0 {
+		diagnostics = append(diagnostics, TemplateDiagnostic{File: path, Message: "template is invalid"})
+	}
+	return diagnostics
+}
+
+// jsonDiagnostic points at the position of a JSON syntax error in file
+func jsonDiagnostic(file string, err *json.SyntaxError) TemplateDiagnostic {
+	d := TemplateDiagnostic{File: file, Message: err.Error()}
+	if data, readErr := os.ReadFile(file); readErr == nil {
+		d.Line, d.Column = lineColumn(string(data), int(min(err.Offset, int64(len(data)))))
+	}
+	return d
+}
+
+// locateVariable points at the first tag using variable in the template files,
+// or at the template directory when no tag matches
+func locateVariable(path string, template Template, variable string) TemplateDiagnostic {
+	last := variable[strings.LastIndexByte(variable, '.')+1:]
+	for _, name := range []string{variable, last} {
+		for _, part := range []struct {
+			file    string
+			content string
+		}{
+			{TemplateSubjectFile, template.Subject},
+			{TemplateHTMLFile, template.HTMLBody},
+			{TemplateTextFile, template.TextBody},
+		} {
+			if offset := findMustachioTag(part.content, name); offset >= 0 {
+				line, col := lineColumn(part.content, offset)
+				return TemplateDiagnostic{File: filepath.Join(path, part.file), Line: line, Column: col}
+			}
+		}
+	}
+	return TemplateDiagnostic{File: path}
+}
+
+// findMustachioTag returns the offset of the first tag whose path is name or ends with .name
+func findMustachioTag(content, name string) int {
+	for pos := 0; ; {
+		start := strings.Index(content[pos:], "{{")
+		if start < 0 {
+			return -1
+		}
+		start += pos
+		end := strings.Index(content[start:], "}}")
+		if end < 0 {
+			return -1
+		}
+		tag := strings.Trim(content[start+2:start+end], "{}#^/&! \t")
+		tag = strings.TrimSpace(strings.TrimPrefix(tag, "each "))
+		for strings.HasPrefix(tag, "../") {
+			tag = tag[3:]
+		}
+		if tag == name || strings.HasSuffix(tag, "."+name) {
+			return start
+		}
+		pos = start + end + 2
+	}
+}
+
+// lineColumn converts a byte offset into a 1-based line and column
+func lineColumn(content string, offset int) (int, int) {
+	before := content[:offset]
+	line := strings.Count(before, "\n") + 1
+	col := utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:]) + 1
+	return line, col
+}
+
+// modelValueHasPath reports whether a decoded JSON model holds a value at path,
+// looking into the first item of lists
+func modelValueHasPath(model interface{}, path string) bool {
+	for _, key := range strings.Split(path, ".") {
+		if list, ok := model.([]interface{}); ok {
+			if len(list) == 0 {
+				return true
+			}
+			model = list[0]
+		}
+		object, ok := model.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if model, ok = object[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -3,9 +3,23 @@ package postmark
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
 )
 
+// TemplateType is the kind of template, a standard template used to send email or
+// a layout shared by standard templates
+type TemplateType string
+
+const (
+	// TemplateTypeStandard is a template used to send email
+	TemplateTypeStandard TemplateType = "Standard"
+	// TemplateTypeLayout is a layout wrapping standard templates via {{{@content}}}
+	TemplateTypeLayout TemplateType = "Layout"
+	// TemplateTypeAll matches both types when filtering
+	TemplateTypeAll TemplateType = "All"
+)
+
 // Template represents an email template on the server
 type Template struct {
 	// TemplateID: ID of template
@@ -22,6 +36,12 @@ type Template struct {
 	AssociatedServerID int64 `json:"AssociatedServerId"`
 	// Active: Indicates that this template may be used for sending email.
 	Active bool
+	// Alias: Optional string used to identify the template instead of its ID.
+	Alias string `json:",omitempty"`
+	// TemplateType: Standard or Layout. Defaults to Standard, and cannot be changed after creation.
+	TemplateType TemplateType `json:",omitempty"`
+	// LayoutTemplate: The alias of the layout template used by this standard template.
+	LayoutTemplate string `json:",omitempty"`
 }
 
 // TemplateInfo is a limited set of template info returned via Index/Editing endpoints
@@ -32,14 +52,20 @@ type TemplateInfo struct {
 	Name string
 	// Active: Indicates that this template may be used for sending email.
 	Active bool
+	// Alias: Optional string used to identify the template.
+	Alias string
+	// TemplateType: Standard or Layout.
+	TemplateType TemplateType
+	// LayoutTemplate: The alias of the layout template used by this standard template.
+	LayoutTemplate string
 }
 
-// GetTemplate fetches a specific template via TemplateID
-func (client *Client) GetTemplate(ctx context.Context, templateID string) (Template, error) {
+// GetTemplate fetches a specific template via TemplateID or alias
+func (client *Client) GetTemplate(ctx context.Context, templateIDOrAlias string) (Template, error) {
 	res := Template{}
 	err := client.doRequest(ctx, parameters{
 		Method:    "GET",
-		Path:      fmt.Sprintf("templates/%s", templateID),
+		Path:      fmt.Sprintf("templates/%s", url.PathEscape(templateIDOrAlias)),
 		TokenType: serverToken,
 	}, &res)
 	return res, err
@@ -55,11 +81,30 @@ type templatesResponse struct {
 // Note: TemplateInfo only returns a subset of template attributes, use GetTemplate(id) to
 // retrieve all template info.
 func (client *Client) GetTemplates(ctx context.Context, count int64, offset int64) ([]TemplateInfo, int64, error) {
+	return client.GetTemplatesFiltered(ctx, count, offset, TemplatesFilter{})
+}
+
+// TemplatesFilter narrows down the templates returned by GetTemplatesFiltered
+type TemplatesFilter struct {
+	// TemplateType: Standard, Layout or All. Defaults to All.
+	TemplateType TemplateType
+	// LayoutTemplate: Only return standard templates using the layout with this alias.
+	LayoutTemplate string
+}
+
+// GetTemplatesFiltered is like GetTemplates but only returns the templates matching filter
+func (client *Client) GetTemplatesFiltered(ctx context.Context, count int64, offset int64, filter TemplatesFilter) ([]TemplateInfo, int64, error) {
 	res := templatesResponse{}
 
 	values := &url.Values{}
 	values.Add("count", fmt.Sprintf("%d", count))
 	values.Add("offset", fmt.Sprintf("%d", offset))
+	if filter.TemplateType != "" {
+		values.Add("TemplateType", string(filter.TemplateType))
+	}
+	if filter.LayoutTemplate != "" {
+		values.Add("LayoutTemplate", filter.LayoutTemplate)
+	}
 
 	err := client.doRequest(ctx, parameters{
 		Method:    "GET",
@@ -69,9 +114,34 @@ func (client *Client) GetTemplates(ctx context.Context, count int64, offset int6
 	return res.Templates, res.TotalCount, err
 }
 
+// templatesPageSize is the largest page size accepted by GET /templates
+const templatesPageSize = 500
+
+// GetAllTemplates fetches every template matching filter, paging through GetTemplatesFiltered
+func (client *Client) GetAllTemplates(ctx context.Context, filter TemplatesFilter) ([]TemplateInfo, error) {
+	var all []TemplateInfo
+	for {
+		templates, total, err := client.GetTemplatesFiltered(ctx, templatesPageSize, int64(len(all)), filter)
+		if err != nil {
+			return all, err
+		}
+		all = append(all, templates...)
+		if len(templates) == 0 || int64(len(all)) >= total {
+			return all, nil
+		}
+	}
+}
+
 // CreateTemplate saves a new template to the server
 func (client *Client) CreateTemplate(ctx context.Context, template Template) (TemplateInfo, error) {
 	res := TemplateInfo{}
+	if client.GenerateTextBody {
+		var err error
+		if template, err = template.WithGeneratedTextBody(); err != nil {
+			return res, err
+		}
+	}
+
 	err := client.doRequest(ctx, parameters{
 		Method:    "POST",
 		Path:      "templates",
@@ -81,24 +151,37 @@ func (client *Client) CreateTemplate(ctx context.Context, template Template) (Te
 	return res, err
 }
 
-// EditTemplate updates details for a specific template with templateID
-func (client *Client) EditTemplate(ctx context.Context, templateID string, template Template) (TemplateInfo, error) {
+// EditTemplate updates details for a specific template with templateID or alias.
+// LayoutTemplate is always sent, so an empty LayoutTemplate removes the layout.
+func (client *Client) EditTemplate(ctx context.Context, templateIDOrAlias string, template Template) (TemplateInfo, error) {
+	payload := templateEditPayload{Template: template}
+	if template.LayoutTemplate != "" {
+		payload.LayoutTemplate = &template.LayoutTemplate
+	}
+
 	res := TemplateInfo{}
 	err := client.doRequest(ctx, parameters{
 		Method:    "PUT",
-		Path:      fmt.Sprintf("templates/%s", templateID),
-		Payload:   template,
+		Path:      fmt.Sprintf("templates/%s", url.PathEscape(templateIDOrAlias)),
+		Payload:   payload,
 		TokenType: serverToken,
 	}, &res)
 	return res, err
 }
 
-// DeleteTemplate removes a template (with templateID) from the server
-func (client *Client) DeleteTemplate(ctx context.Context, templateID string) error {
+// templateEditPayload always sends LayoutTemplate, as null when the template
+// has no layout, so that editing a template can remove its layout
+type templateEditPayload struct {
+	Template
+	LayoutTemplate *string
+}
+
+// DeleteTemplate removes a template (with templateID or alias) from the server
+func (client *Client) DeleteTemplate(ctx context.Context, templateIDOrAlias string) error {
 	res := APIError{}
 	err := client.doRequest(ctx, parameters{
 		Method:    "DELETE",
-		Path:      fmt.Sprintf("templates/%s", templateID),
+		Path:      fmt.Sprintf("templates/%s", url.PathEscape(templateIDOrAlias)),
 		TokenType: serverToken,
 	}, &res)
 
@@ -109,6 +192,62 @@ func (client *Client) DeleteTemplate(ctx context.Context, templateID string) err
 	return err
 }
 
+// PushTemplatesRequest is the request body for PushTemplates
+type PushTemplatesRequest struct {
+	// SourceServerID: ID of the server to copy templates from
+	SourceServerID int64 `json:"SourceServerID"`
+	// DestinationServerID: ID of the server to copy templates to
+	DestinationServerID int64 `json:"DestinationServerID"`
+	// PerformChanges: When false, nothing is changed and the response previews what would be pushed
+	PerformChanges bool `json:"PerformChanges"`
+}
+
+// TemplatePushAction describes what happened, or would happen, to a template on the destination server
+type TemplatePushAction struct {
+	// Action: Create or Edit
+	Action string
+	// TemplateID: ID of the template on the source server
+	TemplateID int64 `json:"TemplateId"`
+	// Alias: Alias of the template, templates are matched between servers by alias
+	Alias string
+	// Name: Name of the template
+	Name string
+	// TemplateType: Standard or Layout
+	TemplateType TemplateType
+}
+
+// PushTemplatesResponse lists the templates pushed to the destination server
+type PushTemplatesResponse struct {
+	// TotalCount: Number of templates pushed
+	TotalCount int64
+	// Templates: The action for each template
+	Templates []TemplatePushAction
+}
+
+// PushTemplates copies templates having an alias from one server to another.
+// Templates are matched by alias, and are created or edited on the destination server.
+// Set PerformChanges to false for a dry run, or use PreviewPushTemplates.
+func (client *Client) PushTemplates(ctx context.Context, req PushTemplatesRequest) (PushTemplatesResponse, error) {
+	res := PushTemplatesResponse{}
+	err := client.doRequest(ctx, parameters{
+		Method:    http.MethodPut,
+		Path:      "templates/push",
+		Payload:   req,
+		TokenType: accountToken,
+	}, &res)
+	return res, err
+}
+
+// PreviewPushTemplates returns what PushTemplates would create or change on the
+// destination server, without changing anything
+func (client *Client) PreviewPushTemplates(ctx context.Context, sourceServerID int64, destinationServerID int64) (PushTemplatesResponse, error) {
+	return client.PushTemplates(ctx, PushTemplatesRequest{
+		SourceServerID:      sourceServerID,
+		DestinationServerID: destinationServerID,
+		PerformChanges:      false,
+	})
+}
+
 // ValidateTemplateBody contains the template/render model combination to be validated
 type ValidateTemplateBody struct {
 	Subject                    string
@@ -116,6 +255,10 @@ type ValidateTemplateBody struct {
 	HTMLBody                   string `json:"HTMLBody"`
 	TestRenderModel            map[string]interface{}
 	InlineCSSForHTMLTestRender bool `json:"InlineCssForHtmlTestRender"`
+	// TemplateType: Standard or Layout, a layout must contain {{{@content}}}
+	TemplateType TemplateType `json:",omitempty"`
+	// LayoutTemplate: Alias of the layout used to render a standard template
+	LayoutTemplate string `json:",omitempty"`
 }
 
 // ValidateTemplateResponse contains information as to how the validation went
@@ -215,3 +358,53 @@ func (client *Client) SendTemplatedEmailBatch(ctx context.Context, emails []Temp
 	}, &res)
 	return res, err
 }
+
+// PreviewTemplatedEmail renders email without sending it. The template is
+// fetched by TemplateID or TemplateAlias and rendered with TemplateModel and
+// InlineCSS through ValidateTemplate, and the result is assembled into the Email
+// which would be sent, for display or WriteMIME. A template which does not render
+// returns a TemplateValidationFailedError.
+func (client *Client) PreviewTemplatedEmail(ctx context.Context, email TemplatedEmail) (Email, error) {
+	ref := templateRef(email)
+	template, err := client.GetTemplate(ctx, ref)
+	if err != nil {
+		return Email{}, err
+	}
+
+	body := validateTemplateBodyFor(template)
+	body.TestRenderModel = email.TemplateModel
+	body.InlineCSSForHTMLTestRender = email.InlineCSS
+	res, err := client.ValidateTemplate(ctx, body)
+	if err != nil {
+		return Email{}, err
+	}
+	if !res.AllContentIsValid {
+		return Email{}, TemplateValidationFailedError{Results: map[string]ValidateTemplateResponse{ref: res}}
+	}
+
+	var metadata map[string]string
+	if len(email.Metadata) > 0 {
+		metadata = make(map[string]string, len(email.Metadata))
+		for k, v := range email.Metadata {
+			metadata[k] = fmt.Sprint(v)
+		}
+	}
+
+	return Email{
+		From:          email.From,
+		To:            email.To,
+		Cc:            email.Cc,
+		Bcc:           email.Bcc,
+		Subject:       res.Subject.RenderedContent,
+		Tag:           email.Tag,
+		HTMLBody:      res.HTMLBody.RenderedContent,
+		TextBody:      res.TextBody.RenderedContent,
+		ReplyTo:       email.ReplyTo,
+		Headers:       email.Headers,
+		TrackOpens:    email.TrackOpens,
+		TrackLinks:    email.TrackLinks,
+		Attachments:   email.Attachments,
+		Metadata:      metadata,
+		MessageStream: email.MessageStream,
+	}, nil
+}
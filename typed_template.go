@@ -0,0 +1,236 @@
+package postmark
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// TypedTemplate binds a template alias to the Go type of its model, so that the
+// model is checked by the compiler when sending and can be compared with the
+// variables the template actually uses
+type TypedTemplate[M any] struct {
+	// Alias of the template
+	Alias string
+	// Defaults holds the fields shared by every message, such as From, Tag or
+	// MessageStream. TemplateAlias, To and TemplateModel are set by Email.
+	Defaults TemplatedEmail
+}
+
+// NewTypedTemplate builds a TypedTemplate for the template alias
+func NewTypedTemplate[M any](alias string) TypedTemplate[M] {
+	return TypedTemplate[M]{Alias: alias}
+}
+
+// Email builds the TemplatedEmail sending model to the recipient. The model is
+// converted following its json struct tags and must encode to a JSON object.
+func (t TypedTemplate[M]) Email(to string, model M) (TemplatedEmail, error) {
+	email := t.Defaults
+	email.TemplateID = 0
+	email.TemplateAlias = t.Alias
+	email.To = to
+
+	data, err := json.Marshal(model)
+	if err != nil {
+		return email, err
+	}
+	email.TemplateModel = map[string]interface{}{}
+	if err = json.Unmarshal(data, &email.TemplateModel); err != nil {
+		return email, fmt.Errorf("postmark: template model %T is not a JSON object: %w", model, err)
+	}
+	return email, nil
+}
+
+// Send sends the template to the recipient with model
+func (t TypedTemplate[M]) Send(ctx context.Context, client Sender, to string, model M) (EmailResponse, error) {
+	email, err := t.Email(to, model)
+	if err != nil {
+		return EmailResponse{}, err
+	}
+	return client.SendTemplatedEmail(ctx, email)
+}
+
+// CheckModel fetches the template, validates it to obtain its
+// SuggestedTemplateModel, and compares it with the JSON fields of M, see CompareModel
+func (t TypedTemplate[M]) CheckModel(ctx context.Context, client *Client) error {
+	template, err := client.GetTemplate(ctx, t.Alias)
+	if err != nil {
+		return err
+	}
+	res, err := client.ValidateTemplate(ctx, validateTemplateBodyFor(template))
+	if err != nil {
+		return err
+	}
+	if !res.AllContentIsValid {
+		return fmt.Errorf("postmark: template %s is invalid", t.Alias)
+	}
+	return t.CompareModel(res.SuggestedTemplateModel)
+}
+
+// CompareModel compares a SuggestedTemplateModel, from ValidateTemplate or
+// RenderTemplate, with the JSON fields of M. It returns a *TemplateModelMismatchError
+// when the template uses variables M does not have, listing as well the fields of M
+// the template does not use. Maps and interfaces in M match any variable below them.
+func (t TypedTemplate[M]) CompareModel(suggested map[string]interface{}) error {
+	fields := map[string]modelFieldKind{}
+	modelFields(reflect.TypeOf((*M)(nil)).Elem(), "", fields, map[reflect.Type]bool{})
+
+	var used []string
+	suggestedPaths(suggested, "", &used)
+
+	mismatch := &TemplateModelMismatchError{Alias: t.Alias}
+	for _, path := range used {
+		if !modelHasPath(fields, path) {
+			mismatch.Missing = append(mismatch.Missing, path)
+		}
+	}
+	for path, kind := range fields {
+		if kind == modelFieldObject {
+			continue
+		}
+		if !pathIsUsed(used, path) {
+			mismatch.Unused = append(mismatch.Unused, path)
+		}
+	}
+	if len(mismatch.Missing) == 0 {
+		return nil
+	}
+	sort.Strings(mismatch.Missing)
+	sort.Strings(mismatch.Unused)
+	return mismatch
+}
+
+// TemplateModelMismatchError reports the differences between a template and its Go model
+type TemplateModelMismatchError struct {
+	// Alias of the template
+	Alias string
+	// Missing lists the variables used by the template which are not in the model
+	Missing []string
+	// Unused lists the model fields which the template does not use
+	Unused []string
+}
+
+// Error lists the missing and unused fields
+func (err *TemplateModelMismatchError) Error() string {
+	msg := fmt.Sprintf("postmark: template %s uses fields missing from the model: %s",
+		err.Alias, strings.Join(err.Missing, ", "))
+	if len(err.Unused) > 0 {
+		msg += "; unused model fields: " + strings.Join(err.Unused, ", ")
+	}
+	return msg
+}
+
+type modelFieldKind int
+
+const (
+	modelFieldLeaf modelFieldKind = iota
+	modelFieldObject
+	// modelFieldAny is a map or interface, matching any nested path
+	modelFieldAny
+)
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// modelFields records the JSON paths of typ into fields. Slices are transparent,
+// as Mustachio iterates them with both {{#each}} and sections.
+func modelFields(typ reflect.Type, prefix string, fields map[string]modelFieldKind, visiting map[reflect.Type]bool) {
+	for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+		typ = typ.Elem()
+	}
+
+	kind := modelFieldLeaf
+	switch {
+	case typ.Implements(jsonMarshalerType) || reflect.PointerTo(typ).Implements(jsonMarshalerType),
+		typ.Implements(textMarshalerType) || reflect.PointerTo(typ).Implements(textMarshalerType):
+	case typ.Kind() == reflect.Map, typ.Kind() == reflect.Interface:
+		kind = modelFieldAny
+	case typ.Kind() == reflect.Struct:
+		kind = modelFieldObject
+	}
+	if prefix != "" {
+		fields[prefix] = kind
+	}
+	if kind != modelFieldObject || visiting[typ] {
+		return
+	}
+
+	visiting[typ] = true
+	defer delete(visiting, typ)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				modelFields(embedded, prefix, fields, visiting)
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		modelFields(field.Type, joinMustachioPath(prefix, name), fields, visiting)
+	}
+}
+
+// suggestedPaths appends the leaf paths of a SuggestedTemplateModel to paths.
+// Empty objects come from sections without variables and are leaves as well.
+func suggestedPaths(value interface{}, prefix string, paths *[]string) {
+	if list, ok := value.([]interface{}); ok {
+		if len(list) == 0 {
+			value = nil
+		} else {
+			value = list[0]
+		}
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok || len(object) == 0 {
+		if prefix != "" {
+			*paths = append(*paths, prefix)
+		}
+		return
+	}
+	for key, child := range object {
+		suggestedPaths(child, joinMustachioPath(prefix, key), paths)
+	}
+}
+
+// modelHasPath reports whether the template variable at path resolves in the model
+func modelHasPath(fields map[string]modelFieldKind, path string) bool {
+	if _, ok := fields[path]; ok {
+		return true
+	}
+	for i, c := range path {
+		if c == '.' && fields[path[:i]] == modelFieldAny {
+			return true
+		}
+	}
+	return false
+}
+
+// pathIsUsed reports whether a model field is used by the template, directly,
+// through a nested variable, or as a section around a parent variable
+func pathIsUsed(used []string, path string) bool {
+	for _, u := range used {
+		if u == path || strings.HasPrefix(u, path+".") || strings.HasPrefix(path, u+".") {
+			return true
+		}
+	}
+	return false
+}
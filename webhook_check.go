@@ -0,0 +1,193 @@
+package postmark
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrNoWebhookTriggers is returned when checking a webhook with no enabled trigger
+var ErrNoWebhookTriggers = errors.New("postmark: webhook has no enabled trigger")
+
+// defaultWebhookCheckTimeout matches the time Postmark waits for a webhook response
+const defaultWebhookCheckTimeout = 10 * time.Second
+
+// WebhookCheckResult is the response of an endpoint to the sample payload of a trigger
+type WebhookCheckResult struct {
+	// Trigger: record type of the sample payload
+	Trigger WebhookRecordType
+	// WebhookAttempt: status code, latency and response body
+	WebhookAttempt
+	// TLSError: the transport error when it is caused by the TLS handshake or
+	// certificate, such as an expired or self-signed certificate
+	TLSError error
+}
+
+// WebhookCheckReport is the result of WebhookChecker.Check
+type WebhookCheckReport struct {
+	// URL of the checked webhook, with its password redacted
+	URL     string
+	Results []WebhookCheckResult
+}
+
+// Healthy reports whether the endpoint accepted every sample payload
+func (report WebhookCheckReport) Healthy() bool {
+	for _, result := range report.Results {
+		if !result.Accepted() {
+			return false
+		}
+	}
+	return len(report.Results) > 0
+}
+
+// String formats the report, one line per trigger
+func (report WebhookCheckReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s\n", report.URL)
+	for _, result := range report.Results {
+		status := "ok"
+		switch {
+		case result.TLSError != nil:
+			status = "TLS error: " + result.TLSError.Error()
+		case result.Err != nil:
+			status = "error: " + result.Err.Error()
+		case !result.Accepted():
+			status = fmt.Sprintf("rejected: %q", strings.TrimSpace(result.Body))
+		}
+		fmt.Fprintf(&sb, "  %-18s %3d %8s  %s\n",
+			result.Trigger, result.StatusCode, result.Latency.Round(time.Millisecond), status)
+	}
+	return sb.String()
+}
+
+// WebhookChecker test-fires a webhook: it POSTs a sample payload for each
+// enabled trigger to the webhook URL, with its basic auth credentials and
+// headers, to catch misconfigured endpoints before real events are dropped.
+// Endpoints should acknowledge the samples, see SampleWebhookEvent, as they
+// carry random message IDs.
+type WebhookChecker struct {
+	// HTTPClient is &http.Client{} by default
+	HTTPClient *http.Client
+	// Timeout of each request, 10 seconds by default
+	Timeout time.Duration
+}
+
+// Check sends a sample payload for each trigger enabled on webhook, in turn, on
+// the message stream of webhook
+func (c *WebhookChecker) Check(ctx context.Context, webhook Webhook) (WebhookCheckReport, error) {
+	report := WebhookCheckReport{URL: redactURL(webhook.URL)}
+
+	triggers := webhookEnabledTriggers(webhook.Triggers)
+	if len(triggers) == 0 {
+		return report, ErrNoWebhookTriggers
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookCheckTimeout
+	}
+
+	for _, trigger := range triggers {
+		event, err := SampleWebhookEvent(trigger)
+		if err != nil {
+			return report, err
+		}
+		setWebhookEventStream(event, webhook.MessageStream)
+		payload, err := webhookPayload(event)
+		if err != nil {
+			return report, err
+		}
+
+		reqCtx, cancel := context.WithTimeout(ctx, timeout)
+		result := WebhookCheckResult{Trigger: trigger, WebhookAttempt: postWebhook(reqCtx, c.HTTPClient, webhook, payload)}
+		cancel()
+		if isTLSError(result.Err) {
+			result.TLSError = result.Err
+		}
+		report.Results = append(report.Results, result)
+
+		if err = ctx.Err(); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// CheckWebhook fetches the webhook with the given ID and test-fires it with a
+// default WebhookChecker
+func (client *Client) CheckWebhook(ctx context.Context, id int) (WebhookCheckReport, error) {
+	webhook, err := client.GetWebhook(ctx, id)
+	if err != nil {
+		return WebhookCheckReport{}, err
+	}
+	checker := &WebhookChecker{}
+	return checker.Check(ctx, webhook)
+}
+
+// webhookEnabledTriggers lists the record types of the triggers enabled on triggers
+func webhookEnabledTriggers(triggers WebhookTrigger) []WebhookRecordType {
+	var types []WebhookRecordType
+	for _, trigger := range []struct {
+		enabled    bool
+		recordType WebhookRecordType
+	}{
+		{triggers.Delivery.Enabled, DeliveryRecord},
+		{triggers.Bounce.Enabled, BounceRecord},
+		{triggers.SpamComplaint.Enabled, SpamComplaintRecord},
+		{triggers.Open.Enabled, OpenRecord},
+		{triggers.Click.Enabled, ClickRecord},
+		{triggers.SubscriptionChange.Enabled, SubscriptionChangeRecord},
+	} {
+		if trigger.enabled {
+			types = append(types, trigger.recordType)
+		}
+	}
+	return types
+}
+
+// setWebhookEventStream sets the message stream of event, unless stream is empty
+func setWebhookEventStream(event WebhookEvent, stream string) {
+	if stream == "" {
+		return
+	}
+	switch e := event.(type) {
+	case *DeliveryEvent:
+		e.MessageStream = stream
+	case *BounceEvent:
+		e.MessageStream = stream
+	case *SpamComplaintEvent:
+		e.MessageStream = stream
+	case *OpenEvent:
+		e.MessageStream = stream
+	case *ClickEvent:
+		e.MessageStream = stream
+	case *SubscriptionChangeEvent:
+		e.MessageStream = stream
+	case *InboundEvent:
+		e.MessageStream = stream
+	}
+}
+
+// isTLSError reports whether err comes from the TLS handshake or certificate verification
+func isTLSError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	return errors.As(err, &certErr) ||
+		errors.As(err, &recordErr) ||
+		errors.As(err, &alertErr) ||
+		errors.As(err, &unknownAuthority) ||
+		errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr)
+}
@@ -0,0 +1,201 @@
+package postmark
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errWebhookInProgress is returned for duplicates of an event still being
+// processed, so that Postmark retries them once the first delivery completes
+var errWebhookInProgress = fmt.Errorf("%w: event is being processed", ErrRetryWebhook)
+
+// WebhookDedupStatus is the state of an event key in a WebhookDedupStore
+type WebhookDedupStatus int
+
+const (
+	// WebhookEventNew: the key was claimed by the caller, which should process the event
+	WebhookEventNew WebhookDedupStatus = iota
+	// WebhookEventInProgress: another delivery of the event holds the claim
+	WebhookEventInProgress
+	// WebhookEventProcessed: the event was already processed
+	WebhookEventProcessed
+)
+
+// WebhookDedupStore records which webhook events were processed
+type WebhookDedupStore interface {
+	// Claim claims key until now+lease, unless it is processed or claimed by
+	// another delivery whose lease has not expired
+	Claim(ctx context.Context, key string, now time.Time, lease time.Duration) (WebhookDedupStatus, error)
+	// Complete marks a claimed key as processed
+	Complete(ctx context.Context, key string, now time.Time) error
+	// Release drops the claim on key, so that a retry processes the event again
+	Release(ctx context.Context, key string) error
+}
+
+// WebhookDeduplicator makes each webhook event reach the callbacks of a
+// WebhookHandler once, as Postmark retries deliveries. An event is claimed in
+// Store before the callback runs, marked processed when it succeeds, and
+// released when it fails so that the retry processes it. Duplicates of a
+// processed event are acknowledged, duplicates of an event being processed are
+// answered with a retry.
+type WebhookDeduplicator struct {
+	// Store of processed events
+	Store WebhookDedupStore
+	// Key identifies an event, DefaultWebhookKey by default. Keys are hashed
+	// before being stored.
+	Key func(event WebhookEvent) string
+	// Lease: how long a claim protects an event being processed, 5 minutes by default
+	Lease time.Duration
+	// Now returns the current time, time.Now by default
+	Now func() time.Time
+}
+
+// NewWebhookDeduplicator builds a WebhookDeduplicator with the default key
+func NewWebhookDeduplicator(store WebhookDedupStore) *WebhookDeduplicator {
+	return &WebhookDeduplicator{Store: store}
+}
+
+// DefaultWebhookKey identifies an event by record type, message ID, recipient and time
+func DefaultWebhookKey(event WebhookEvent) string {
+	record := event.Record()
+	return strings.Join([]string{
+		string(record.Type),
+		record.MessageID,
+		strings.ToLower(record.Recipient),
+		record.At.UTC().Format(time.RFC3339Nano),
+	}, "\x00")
+}
+
+// Process calls fn with event unless the event was already processed
+func (d *WebhookDeduplicator) Process(ctx context.Context, event WebhookEvent, fn func(context.Context, WebhookEvent) error) error {
+	keyFunc := d.Key
+	if keyFunc == nil {
+		keyFunc = DefaultWebhookKey
+	}
+	sum := sha256.Sum256([]byte(keyFunc(event)))
+	key := hex.EncodeToString(sum[:])
+
+	lease := d.Lease
+	if lease <= 0 {
+		lease = 5 * time.Minute
+	}
+
+	status, err := d.Store.Claim(ctx, key, d.now(), lease)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRetryWebhook, err)
+	}
+	switch status {
+	case WebhookEventProcessed:
+		return nil
+	case WebhookEventInProgress:
+		return errWebhookInProgress
+	}
+
+	if err = fn(ctx, event); err != nil {
+		if releaseErr := d.Store.Release(ctx, key); releaseErr != nil {
+			return errors.Join(err, releaseErr)
+		}
+		return err
+	}
+	if err = d.Store.Complete(ctx, key, d.now()); err != nil {
+		return fmt.Errorf("postmark: event processed but not recorded: %w", err)
+	}
+	return nil
+}
+
+func (d *WebhookDeduplicator) now() time.Time {
+	if d.Now != nil {
+		return d.Now()
+	}
+	return time.Now()
+}
+
+// MemoryWebhookDedupStore is a WebhookDedupStore kept in memory, remembering the
+// most recently seen Capacity keys
+type MemoryWebhookDedupStore struct {
+	// Capacity: number of keys kept, 100000 by default
+	Capacity int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type webhookDedupEntry struct {
+	key          string
+	processed    bool
+	claimedUntil time.Time
+}
+
+var _ WebhookDedupStore = (*MemoryWebhookDedupStore)(nil)
+
+// NewMemoryWebhookDedupStore builds an empty MemoryWebhookDedupStore keeping capacity keys
+func NewMemoryWebhookDedupStore(capacity int) *MemoryWebhookDedupStore {
+	return &MemoryWebhookDedupStore{Capacity: capacity}
+}
+
+// Claim claims key, evicting the least recently used keys beyond Capacity
+func (store *MemoryWebhookDedupStore) Claim(_ context.Context, key string, now time.Time, lease time.Duration) (WebhookDedupStatus, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.entries == nil {
+		store.entries = map[string]*list.Element{}
+		store.order = list.New()
+	}
+
+	if elem, ok := store.entries[key]; ok {
+		store.order.MoveToFront(elem)
+		entry := elem.Value.(*webhookDedupEntry)
+		switch {
+		case entry.processed:
+			return WebhookEventProcessed, nil
+		case now.Before(entry.claimedUntil):
+			return WebhookEventInProgress, nil
+		}
+		entry.claimedUntil = now.Add(lease)
+		return WebhookEventNew, nil
+	}
+
+	store.entries[key] = store.order.PushFront(&webhookDedupEntry{key: key, claimedUntil: now.Add(lease)})
+	capacity := store.Capacity
+	if capacity <= 0 {
+		capacity = 100000
+	}
+	for store.order.Len() > capacity {
+		oldest := store.order.Back()
+		store.order.Remove(oldest)
+		delete(store.entries, oldest.Value.(*webhookDedupEntry).key)
+	}
+	return WebhookEventNew, nil
+}
+
+// Complete marks key as processed
+func (store *MemoryWebhookDedupStore) Complete(_ context.Context, key string, _ time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if elem, ok := store.entries[key]; ok {
+		elem.Value.(*webhookDedupEntry).processed = true
+	}
+	return nil
+}
+
+// Release forgets key unless it was processed
+func (store *MemoryWebhookDedupStore) Release(_ context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if elem, ok := store.entries[key]; ok && !elem.Value.(*webhookDedupEntry).processed {
+		store.order.Remove(elem)
+		delete(store.entries, key)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package postmark
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const defaultWebhookDedupTable = "postmark_webhook_events"
+
+// SQLWebhookDedupStore is a WebhookDedupStore backed by database/sql, so that
+// processed events are remembered across restarts and shared between
+// instances. Call CreateTable once to set up the table, and Prune periodically.
+type SQLWebhookDedupStore struct {
+	// DB is the database holding the table
+	DB *sql.DB
+	// Table name, postmark_webhook_events by default
+	Table string
+	// Placeholder is the bind parameter style of the driver
+	Placeholder SQLPlaceholder
+}
+
+var _ WebhookDedupStore = (*SQLWebhookDedupStore)(nil)
+
+// NewSQLWebhookDedupStore builds a SQLWebhookDedupStore using the default table name
+func NewSQLWebhookDedupStore(db *sql.DB, placeholder SQLPlaceholder) *SQLWebhookDedupStore {
+	return &SQLWebhookDedupStore{DB: db, Placeholder: placeholder}
+}
+
+// CreateTable creates the table and its index if they do not exist
+func (store *SQLWebhookDedupStore) CreateTable(ctx context.Context) error {
+	table, err := sqlTableName(store.Table, defaultWebhookDedupTable)
+	if err != nil {
+		return err
+	}
+
+	if _, err = store.DB.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	event_key VARCHAR(64) PRIMARY KEY,
+	processed INTEGER NOT NULL,
+	claimed_until BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL
+)`, table)); err != nil {
+		return err
+	}
+
+	_, err = store.DB.ExecContext(ctx, fmt.Sprintf(
+		`CREATE INDEX IF NOT EXISTS %s_updated ON %s (updated_at)`,
+		safeIndexPrefix(table), table,
+	))
+	return err
+}
+
+// Claim inserts key, or takes over a claim whose lease expired with a
+// conditional update, so concurrent deliveries never both process an event
+func (store *SQLWebhookDedupStore) Claim(ctx context.Context, key string, now time.Time, lease time.Duration) (WebhookDedupStatus, error) {
+	table, err := sqlTableName(store.Table, defaultWebhookDedupTable)
+	if err != nil {
+		return WebhookEventNew, err
+	}
+
+	_, insertErr := store.DB.ExecContext(ctx, store.Placeholder.rebind(fmt.Sprintf(
+		`INSERT INTO %s (event_key, processed, claimed_until, updated_at) VALUES (?, 0, ?, ?)`, table)),
+		key, sqlTime(now.Add(lease)), sqlTime(now),
+	)
+	if insertErr == nil {
+		return WebhookEventNew, nil
+	}
+
+	// The insert failed, most likely on the primary key
+	var processed int
+	var claimedUntil int64
+	err = store.DB.QueryRowContext(ctx, store.Placeholder.rebind(fmt.Sprintf(
+		`SELECT processed, claimed_until FROM %s WHERE event_key = ?`, table)), key,
+	).Scan(&processed, &claimedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return WebhookEventNew, insertErr
+	}
+	if err != nil {
+		return WebhookEventNew, err
+	}
+	if processed != 0 {
+		return WebhookEventProcessed, nil
+	}
+	if claimedUntil > sqlTime(now) {
+		return WebhookEventInProgress, nil
+	}
+
+	res, err := store.DB.ExecContext(ctx, store.Placeholder.rebind(fmt.Sprintf(
+		`UPDATE %s SET claimed_until = ?, updated_at = ? WHERE event_key = ? AND processed = 0 AND claimed_until = ?`, table)),
+		sqlTime(now.Add(lease)), sqlTime(now), key, claimedUntil,
+	)
+	if err != nil {
+		return WebhookEventNew, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return WebhookEventInProgress, err
+	}
+	return WebhookEventNew, nil
+}
+
+// Complete marks key as processed
+func (store *SQLWebhookDedupStore) Complete(ctx context.Context, key string, now time.Time) error {
+	table, err := sqlTableName(store.Table, defaultWebhookDedupTable)
+	if err != nil {
+		return err
+	}
+	_, err = store.DB.ExecContext(ctx, store.Placeholder.rebind(fmt.Sprintf(
+		`UPDATE %s SET processed = 1, updated_at = ? WHERE event_key = ?`, table)),
+		sqlTime(now), key,
+	)
+	return err
+}
+
+// Release deletes key unless it was processed
+func (store *SQLWebhookDedupStore) Release(ctx context.Context, key string) error {
+	table, err := sqlTableName(store.Table, defaultWebhookDedupTable)
+	if err != nil {
+		return err
+	}
+	_, err = store.DB.ExecContext(ctx, store.Placeholder.rebind(fmt.Sprintf(
+		`DELETE FROM %s WHERE event_key = ? AND processed = 0`, table)), key,
+	)
+	return err
+}
+
+// Prune deletes the keys last updated before the given time and returns how
+// many were deleted. Postmark retries for up to a few days, so keys should be
+// kept for longer than that.
+func (store *SQLWebhookDedupStore) Prune(ctx context.Context, before time.Time) (int64, error) {
+	table, err := sqlTableName(store.Table, defaultWebhookDedupTable)
+	if err != nil {
+		return 0, err
+	}
+	res, err := store.DB.ExecContext(ctx, store.Placeholder.rebind(fmt.Sprintf(
+		`DELETE FROM %s WHERE updated_at < ?`, table)), sqlTime(before),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
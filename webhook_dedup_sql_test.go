@@ -0,0 +1,75 @@
+package postmark
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openSQLiteWebhookDedupStore opens the store of the SQLite database at path,
+// creating its table
+func openSQLiteWebhookDedupStore(t *testing.T, path string) *SQLWebhookDedupStore {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	store := NewSQLWebhookDedupStore(db, QuestionPlaceholder)
+	if err = store.CreateTable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestSQLWebhookDedupStoreClaim(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "webhooks.db")
+	store := openSQLiteWebhookDedupStore(t, path)
+	now := time.Now()
+
+	claim := func(store *SQLWebhookDedupStore, key string, at time.Time, want WebhookDedupStatus) {
+		t.Helper()
+		if status, err := store.Claim(ctx, key, at, time.Minute); err != nil || status != want {
+			t.Fatalf("Claim(%q) returned %v, %v, want %v", key, status, err, want)
+		}
+	}
+
+	claim(store, "event", now, WebhookEventNew)
+	claim(store, "event", now.Add(30*time.Second), WebhookEventInProgress)
+	// The claim of a crashed delivery expires with its lease
+	claim(store, "event", now.Add(2*time.Minute), WebhookEventNew)
+
+	if err := store.Release(ctx, "event"); err != nil {
+		t.Fatal(err)
+	}
+	claim(store, "event", now.Add(2*time.Minute), WebhookEventNew)
+
+	if err := store.Complete(ctx, "event", now.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Release(ctx, "event"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Processed keys outlive the process
+	reopened := openSQLiteWebhookDedupStore(t, path)
+	claim(reopened, "event", now.Add(time.Hour), WebhookEventProcessed)
+	claim(reopened, "other", now.Add(time.Hour), WebhookEventNew)
+
+	if n, err := reopened.Prune(ctx, now.Add(time.Minute)); err != nil || n != 0 {
+		t.Fatalf("Prune returned %d, %v, want nothing pruned", n, err)
+	}
+	if n, err := reopened.Prune(ctx, now.Add(2*time.Hour)); err != nil || n != 2 {
+		t.Fatalf("Prune returned %d, %v, want 2 keys pruned", n, err)
+	}
+	claim(reopened, "event", now.Add(2*time.Hour), WebhookEventNew)
+}
@@ -0,0 +1,70 @@
+package postmark
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryWebhookDedupStoreClaim(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryWebhookDedupStore(10)
+	now := time.Now()
+
+	claim := func(key string, at time.Time, want WebhookDedupStatus) {
+		t.Helper()
+		if status, err := store.Claim(ctx, key, at, time.Minute); err != nil || status != want {
+			t.Fatalf("Claim(%q) returned %v, %v, want %v", key, status, err, want)
+		}
+	}
+
+	claim("event", now, WebhookEventNew)
+	claim("event", now.Add(30*time.Second), WebhookEventInProgress)
+	// The claim of a crashed delivery expires with its lease
+	claim("event", now.Add(2*time.Minute), WebhookEventNew)
+
+	if err := store.Release(ctx, "event"); err != nil {
+		t.Fatal(err)
+	}
+	claim("event", now.Add(2*time.Minute), WebhookEventNew)
+
+	if err := store.Complete(ctx, "event", now); err != nil {
+		t.Fatal(err)
+	}
+	claim("event", now.Add(time.Hour), WebhookEventProcessed)
+
+	// Processed keys are not released
+	if err := store.Release(ctx, "event"); err != nil {
+		t.Fatal(err)
+	}
+	claim("event", now.Add(time.Hour), WebhookEventProcessed)
+}
+
+func TestMemoryWebhookDedupStoreEviction(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryWebhookDedupStore(2)
+	now := time.Now()
+
+	for _, key := range []string{"a", "b"} {
+		if _, err := store.Claim(ctx, key, now, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Complete(ctx, key, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Seeing a again makes b the least recently used key, evicted by c
+	if status, _ := store.Claim(ctx, "a", now, time.Minute); status != WebhookEventProcessed {
+		t.Fatalf("a is %v, want processed", status)
+	}
+	if status, _ := store.Claim(ctx, "c", now, time.Minute); status != WebhookEventNew {
+		t.Fatalf("c is %v, want new", status)
+	}
+	if status, _ := store.Claim(ctx, "a", now, time.Minute); status != WebhookEventProcessed {
+		t.Fatalf("a is %v after evicting b, want processed", status)
+	}
+	if status, _ := store.Claim(ctx, "b", now, time.Minute); status != WebhookEventNew {
+		t.Fatalf("b is %v, want new after its eviction", status)
+	}
+}
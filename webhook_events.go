@@ -0,0 +1,407 @@
+package postmark
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnknownWebhookRecordType is returned by ParseWebhook for payloads of an unknown RecordType
+var ErrUnknownWebhookRecordType = errors.New("postmark: unknown webhook record type")
+
+// WebhookRecordType identifies the kind of a webhook payload
+type WebhookRecordType string
+
+const (
+	// DeliveryRecord is posted when a message is accepted by the receiving server
+	DeliveryRecord WebhookRecordType = "Delivery"
+	// BounceRecord is posted when a message bounces
+	BounceRecord WebhookRecordType = "Bounce"
+	// SpamComplaintRecord is posted when a recipient marks a message as spam
+	SpamComplaintRecord WebhookRecordType = "SpamComplaint"
+	// OpenRecord is posted when a recipient opens a message
+	OpenRecord WebhookRecordType = "Open"
+	// ClickRecord is posted when a recipient clicks a tracked link
+	ClickRecord WebhookRecordType = "Click"
+	// SubscriptionChangeRecord is posted when a recipient is suppressed or reactivated
+	SubscriptionChangeRecord WebhookRecordType = "SubscriptionChange"
+	// InboundRecord is posted when an inbound message is received
+	InboundRecord WebhookRecordType = "Inbound"
+)
+
+// WebhookRecord holds the fields common to every webhook event
+type WebhookRecord struct {
+	// Type of the event
+	Type WebhookRecordType
+	// MessageID of the message the event is about
+	MessageID string
+	// Recipient of the message, or the original recipient of an inbound message
+	Recipient string
+	// At is the time of the event
+	At time.Time
+	// MessageStream of the message
+	MessageStream string
+}
+
+// WebhookEvent is a parsed webhook payload: a *DeliveryEvent, *BounceEvent,
+// *SpamComplaintEvent, *OpenEvent, *ClickEvent, *SubscriptionChangeEvent or *InboundEvent
+type WebhookEvent interface {
+	// Record returns the fields common to every event
+	Record() WebhookRecord
+}
+
+// BounceTypeCode is the numeric code of a bounce type
+// https://postmarkapp.com/developer/api/bounce-api#bounce-types
+type BounceTypeCode int64
+
+// Bounce type codes
+const (
+	HardBounceCode              BounceTypeCode = 1
+	TransientBounceCode         BounceTypeCode = 2
+	UnsubscribeCode             BounceTypeCode = 16
+	SubscribeCode               BounceTypeCode = 32
+	AutoResponderCode           BounceTypeCode = 64
+	AddressChangeCode           BounceTypeCode = 128
+	DNSErrorCode                BounceTypeCode = 256
+	SpamNotificationCode        BounceTypeCode = 512
+	OpenRelayTestCode           BounceTypeCode = 1024
+	UnknownBounceCode           BounceTypeCode = 2048
+	SoftBounceCode              BounceTypeCode = 4096
+	VirusNotificationCode       BounceTypeCode = 8192
+	ChallengeVerificationCode   BounceTypeCode = 16384
+	BadEmailAddressCode         BounceTypeCode = 100000
+	SpamComplaintCode           BounceTypeCode = 100001
+	ManuallyDeactivatedCode     BounceTypeCode = 100002
+	UnconfirmedCode             BounceTypeCode = 100003
+	BlockedCode                 BounceTypeCode = 100006
+	SMTPAPIErrorCode            BounceTypeCode = 100007
+	InboundErrorCode            BounceTypeCode = 100008
+	DMARCPolicyCode             BounceTypeCode = 100009
+	TemplateRenderingFailedCode BounceTypeCode = 100010
+)
+
+var bounceTypeNames = map[BounceTypeCode]string{
+	HardBounceCode:              "HardBounce",
+	TransientBounceCode:         "Transient",
+	UnsubscribeCode:             "Unsubscribe",
+	SubscribeCode:               "Subscribe",
+	AutoResponderCode:           "AutoResponder",
+	AddressChangeCode:           "AddressChange",
+	DNSErrorCode:                "DnsError",
+	SpamNotificationCode:        "SpamNotification",
+	OpenRelayTestCode:           "OpenRelayTest",
+	UnknownBounceCode:           "Unknown",
+	SoftBounceCode:              "SoftBounce",
+	VirusNotificationCode:       "VirusNotification",
+	ChallengeVerificationCode:   "ChallengeVerification",
+	BadEmailAddressCode:         "BadEmailAddress",
+	SpamComplaintCode:           "SpamComplaint",
+	ManuallyDeactivatedCode:     "ManuallyDeactivated",
+	UnconfirmedCode:             "Unconfirmed",
+	BlockedCode:                 "Blocked",
+	SMTPAPIErrorCode:            "SMTPApiError",
+	InboundErrorCode:            "InboundError",
+	DMARCPolicyCode:             "DMARCPolicy",
+	TemplateRenderingFailedCode: "TemplateRenderingFailed",
+}
+
+// String returns the bounce type name matching the Type field of bounces
+func (code BounceTypeCode) String() string {
+	if name, ok := bounceTypeNames[code]; ok {
+		return name
+	}
+	return "BounceTypeCode(" + strconv.FormatInt(int64(code), 10) + ")"
+}
+
+// IsHard reports whether the bounce is permanent, the address should not be retried
+func (code BounceTypeCode) IsHard() bool {
+	switch code {
+	case HardBounceCode, BadEmailAddressCode, SpamComplaintCode, ManuallyDeactivatedCode, BlockedCode, DMARCPolicyCode:
+		return true
+	}
+	return false
+}
+
+// WebhookClient describes the email client or operating system of an open or click
+type WebhookClient struct {
+	// Name, such as "Chrome 35.0.1916.153"
+	Name string
+	// Company, such as "Google"
+	Company string
+	// Family, such as "Chrome"
+	Family string
+}
+
+// WebhookGeo is the location of an open or click, based on its IP
+type WebhookGeo struct {
+	CountryISOCode string
+	Country        string
+	RegionISOCode  string
+	Region         string
+	City           string
+	Zip            string
+	// Coords: "latitude,longitude"
+	Coords string
+	IP     string
+}
+
+// Coordinates parses Coords into a latitude and a longitude
+func (geo WebhookGeo) Coordinates() (latitude float64, longitude float64, ok bool) {
+	lat, lon, found := strings.Cut(geo.Coords, ",")
+	if !found {
+		return 0, 0, false
+	}
+	var err error
+	if latitude, err = strconv.ParseFloat(strings.TrimSpace(lat), 64); err != nil {
+		return 0, 0, false
+	}
+	if longitude, err = strconv.ParseFloat(strings.TrimSpace(lon), 64); err != nil {
+		return 0, 0, false
+	}
+	return latitude, longitude, true
+}
+
+// DeliveryEvent is the payload of the Delivery webhook
+type DeliveryEvent struct {
+	RecordType    WebhookRecordType
+	MessageStream string
+	// ServerID: ID of the server which sent the message
+	ServerID int64
+	// MessageID: ID of the delivered message
+	MessageID string
+	// Recipient: email address of the recipient
+	Recipient string
+	// Tag of the message
+	Tag string
+	// DeliveredAt: time the receiving server accepted the message
+	DeliveredAt time.Time
+	// Details: response of the receiving server
+	Details string
+	// Metadata of the message
+	Metadata map[string]string
+}
+
+// Record returns the fields common to every event
+func (e *DeliveryEvent) Record() WebhookRecord {
+	return WebhookRecord{Type: DeliveryRecord, MessageID: e.MessageID, Recipient: e.Recipient, At: e.DeliveredAt, MessageStream: e.MessageStream}
+}
+
+// BounceEvent is the payload of the Bounce webhook
+type BounceEvent struct {
+	RecordType    WebhookRecordType
+	MessageStream string
+	// ID of the bounce
+	ID int64
+	// Type: bounce type name, such as "HardBounce"
+	Type string
+	// TypeCode: bounce type code
+	TypeCode BounceTypeCode
+	// Name: bounce type description, such as "Hard bounce"
+	Name string
+	// Tag of the message
+	Tag string
+	// MessageID: ID of the bounced message
+	MessageID string
+	// ServerID: ID of the server which sent the message
+	ServerID int64
+	// Description of the bounce
+	Description string
+	// Details of the bounce
+	Details string
+	// Email: address which bounced
+	Email string
+	// From: sender address of the message
+	From string
+	// BouncedAt: time of the bounce
+	BouncedAt time.Time
+	// DumpAvailable: the raw bounce is available via GetBounceDump
+	DumpAvailable bool
+	// Inactive: the address was deactivated
+	Inactive bool
+	// CanActivate: the address can be reactivated via ActivateBounce
+	CanActivate bool
+	// Subject of the message
+	Subject string
+	// Content: full bounce content, when the trigger includes it
+	Content string
+	// Metadata of the message
+	Metadata map[string]string
+}
+
+// Record returns the fields common to every event
+func (e *BounceEvent) Record() WebhookRecord {
+	return WebhookRecord{Type: BounceRecord, MessageID: e.MessageID, Recipient: e.Email, At: e.BouncedAt, MessageStream: e.MessageStream}
+}
+
+// SpamComplaintEvent is the payload of the SpamComplaint webhook. It has the
+// fields of a bounce, of type SpamComplaint.
+type SpamComplaintEvent BounceEvent
+
+// Record returns the fields common to every event
+func (e *SpamComplaintEvent) Record() WebhookRecord {
+	return WebhookRecord{Type: SpamComplaintRecord, MessageID: e.MessageID, Recipient: e.Email, At: e.BouncedAt, MessageStream: e.MessageStream}
+}
+
+// OpenEvent is the payload of the Open webhook
+type OpenEvent struct {
+	RecordType    WebhookRecordType
+	MessageStream string
+	// FirstOpen: the first open of the message by the recipient
+	FirstOpen bool
+	// Client: email client or browser used to open the message
+	Client WebhookClient
+	// OS: operating system used to open the message
+	OS WebhookClient
+	// Platform: WebMail, Desktop, Mobile or Unknown
+	Platform string
+	// UserAgent of the client
+	UserAgent string
+	// ReadSeconds: reading time in seconds
+	ReadSeconds int64
+	// Geo: location of the open
+	Geo WebhookGeo
+	// MessageID: ID of the opened message
+	MessageID string
+	// ReceivedAt: time of the open
+	ReceivedAt time.Time
+	// Tag of the message
+	Tag string
+	// Recipient: email address of the recipient
+	Recipient string
+	// Metadata of the message
+	Metadata map[string]string
+}
+
+// Record returns the fields common to every event
+func (e *OpenEvent) Record() WebhookRecord {
+	return WebhookRecord{Type: OpenRecord, MessageID: e.MessageID, Recipient: e.Recipient, At: e.ReceivedAt, MessageStream: e.MessageStream}
+}
+
+// ClickEvent is the payload of the Click webhook
+type ClickEvent struct {
+	RecordType    WebhookRecordType
+	MessageStream string
+	// ClickLocation: HTML or Text
+	ClickLocation string
+	// Client: email client or browser used to click
+	Client WebhookClient
+	// OS: operating system used to click
+	OS WebhookClient
+	// Platform: WebMail, Desktop, Mobile or Unknown
+	Platform string
+	// UserAgent of the client
+	UserAgent string
+	// OriginalLink: URL of the clicked link
+	OriginalLink string
+	// Geo: location of the click
+	Geo WebhookGeo
+	// MessageID: ID of the message
+	MessageID string
+	// ReceivedAt: time of the click
+	ReceivedAt time.Time
+	// Tag of the message
+	Tag string
+	// Recipient: email address of the recipient
+	Recipient string
+	// Metadata of the message
+	Metadata map[string]string
+}
+
+// Record returns the fields common to every event
+func (e *ClickEvent) Record() WebhookRecord {
+	return WebhookRecord{Type: ClickRecord, MessageID: e.MessageID, Recipient: e.Recipient, At: e.ReceivedAt, MessageStream: e.MessageStream}
+}
+
+// SubscriptionChangeEvent is the payload of the SubscriptionChange webhook
+type SubscriptionChangeEvent struct {
+	RecordType    WebhookRecordType
+	MessageStream string
+	// MessageID: ID of the message which caused the change, if any
+	MessageID string
+	// ServerID: ID of the server
+	ServerID int64
+	// ChangedAt: time of the change
+	ChangedAt time.Time
+	// Recipient: email address whose subscription changed
+	Recipient string
+	// Origin: Recipient, Customer or Admin
+	Origin string
+	// SuppressSending: the address is now suppressed, false when reactivated
+	SuppressSending bool
+	// SuppressionReason: HardBounce, SpamComplaint or ManualSuppression
+	SuppressionReason string
+	// Tag of the message
+	Tag string
+	// Metadata of the message
+	Metadata map[string]string
+}
+
+// Record returns the fields common to every event
+func (e *SubscriptionChangeEvent) Record() WebhookRecord {
+	return WebhookRecord{Type: SubscriptionChangeRecord, MessageID: e.MessageID, Recipient: e.Recipient, At: e.ChangedAt, MessageStream: e.MessageStream}
+}
+
+// InboundEvent is the payload of the inbound webhook
+type InboundEvent struct {
+	InboundMessageDetail
+	RecordType WebhookRecordType
+}
+
+// Record returns the fields common to every event. At is zero when Date does not parse.
+func (e *InboundEvent) Record() WebhookRecord {
+	at, _ := e.Time()
+	recipient := e.OriginalRecipient
+	if recipient == "" {
+		recipient = e.To
+	}
+	return WebhookRecord{Type: InboundRecord, MessageID: e.MessageID, Recipient: recipient, At: at, MessageStream: e.MessageStream}
+}
+
+// ParseWebhook decodes a webhook payload into the event type matching its
+// RecordType. Inbound payloads without a RecordType are recognized by their
+// OriginalRecipient.
+func ParseWebhook(data []byte) (WebhookEvent, error) {
+	var probe struct {
+		RecordType        WebhookRecordType
+		OriginalRecipient *string
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+
+	var event WebhookEvent
+	switch probe.RecordType {
+	case DeliveryRecord:
+		event = &DeliveryEvent{}
+	case BounceRecord:
+		event = &BounceEvent{}
+	case SpamComplaintRecord:
+		event = &SpamComplaintEvent{}
+	case OpenRecord:
+		event = &OpenEvent{}
+	case ClickRecord:
+		event = &ClickEvent{}
+	case SubscriptionChangeRecord:
+		event = &SubscriptionChangeEvent{}
+	case InboundRecord:
+		event = &InboundEvent{}
+	case "":
+		if probe.OriginalRecipient == nil {
+			return nil, fmt.Errorf("%w: missing RecordType", ErrUnknownWebhookRecordType)
+		}
+		event = &InboundEvent{}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownWebhookRecordType, probe.RecordType)
+	}
+
+	if err := json.Unmarshal(data, event); err != nil {
+		return nil, fmt.Errorf("postmark: decoding %s webhook: %w", event.Record().Type, err)
+	}
+	if inbound, ok := event.(*InboundEvent); ok && inbound.RecordType == "" {
+		inbound.RecordType = InboundRecord
+	}
+	return event, nil
+}
@@ -0,0 +1,204 @@
+package postmark
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrRetryWebhook marks callback errors after which Postmark should retry the
+// webhook, such as a database being unavailable:
+//
+//	return fmt.Errorf("%w: %v", postmark.ErrRetryWebhook, err)
+var ErrRetryWebhook = errors.New("postmark: retry webhook")
+
+// ErrWebhookUnauthorized is reported to OnError for requests failing the
+// HTTPAuth or HTTPHeaders checks
+var ErrWebhookUnauthorized = errors.New("postmark: unauthorized webhook request")
+
+// defaultWebhookMaxBodySize leaves room for inbound messages with attachments
+const defaultWebhookMaxBodySize = 50 << 20
+
+// WebhookHandler is an http.Handler receiving Postmark webhooks. It checks the
+// credentials configured on the Webhook, parses the payload with ParseWebhook
+// and calls the callback matching its record type. Events without a callback
+// are acknowledged and dropped.
+//
+// The handler responds 200 unless a callback returns a retryable error, see
+// ErrRetryWebhook, in which case it responds 500 so that Postmark retries.
+// Other callback errors, as well as payloads which are too large or cannot be
+// parsed, are reported to OnError and acknowledged, since retrying them cannot
+// succeed. Inbound messages are answered with 403 instead, so that Postmark
+// marks them as failed without retrying.
+type WebhookHandler struct {
+	// HTTPAuth: credentials expected in the Authorization header, not checked when nil
+	HTTPAuth *WebhookHTTPAuth
+	// HTTPHeaders: headers expected in every request, with their exact value
+	HTTPHeaders []Header
+	// MaxBodySize: largest accepted payload, 50MB by default
+	MaxBodySize int64
+
+	OnDelivery           func(ctx context.Context, event *DeliveryEvent) error
+	OnBounce             func(ctx context.Context, event *BounceEvent) error
+	OnSpamComplaint      func(ctx context.Context, event *SpamComplaintEvent) error
+	OnOpen               func(ctx context.Context, event *OpenEvent) error
+	OnClick              func(ctx context.Context, event *ClickEvent) error
+	OnSubscriptionChange func(ctx context.Context, event *SubscriptionChangeEvent) error
+	OnInbound            func(ctx context.Context, event *InboundEvent) error
+
+	// IsRetryable decides which callback errors make Postmark retry, besides
+	// those wrapping ErrRetryWebhook
+	IsRetryable func(err error) bool
+	// Deduplicator, when set, drops the events which were already processed
+	Deduplicator *WebhookDeduplicator
+	// OnError is called with every error, including rejected requests
+	OnError func(r *http.Request, err error)
+}
+
+// NewWebhookHandler builds a WebhookHandler checking the HTTPAuth and
+// HTTPHeaders configured on webhook
+func NewWebhookHandler(webhook Webhook) *WebhookHandler {
+	return &WebhookHandler{HTTPAuth: webhook.HTTPAuth, HTTPHeaders: webhook.HTTPHeaders}
+}
+
+// ServeHTTP handles a webhook request
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorized(r) {
+		h.reportError(r, ErrWebhookUnauthorized)
+		if h.HTTPAuth != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="postmark"`)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	maxBodySize := h.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = defaultWebhookMaxBodySize
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		h.reportError(r, err)
+		rejectWebhook(w, looksInbound(body))
+		return
+	}
+
+	event, err := ParseWebhook(body)
+	if errors.Is(err, ErrUnknownWebhookRecordType) {
+		h.reportError(r, err)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		h.reportError(r, err)
+		rejectWebhook(w, looksInbound(body))
+		return
+	}
+
+	if h.Deduplicator != nil {
+		err = h.Deduplicator.Process(r.Context(), event, h.Dispatch)
+	} else {
+		err = h.Dispatch(r.Context(), event)
+	}
+	if err != nil {
+		h.reportError(r, err)
+		switch {
+		case h.retryable(err):
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		default:
+			rejectWebhook(w, event.Record().Type == InboundRecord)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Dispatch calls the callback matching the type of event, if any
+func (h *WebhookHandler) Dispatch(ctx context.Context, event WebhookEvent) error {
+	var err error
+	switch e := event.(type) {
+	case *DeliveryEvent:
+		if h.OnDelivery != nil {
+			err = h.OnDelivery(ctx, e)
+		}
+	case *BounceEvent:
+		if h.OnBounce != nil {
+			err = h.OnBounce(ctx, e)
+		}
+	case *SpamComplaintEvent:
+		if h.OnSpamComplaint != nil {
+			err = h.OnSpamComplaint(ctx, e)
+		}
+	case *OpenEvent:
+		if h.OnOpen != nil {
+			err = h.OnOpen(ctx, e)
+		}
+	case *ClickEvent:
+		if h.OnClick != nil {
+			err = h.OnClick(ctx, e)
+		}
+	case *SubscriptionChangeEvent:
+		if h.OnSubscriptionChange != nil {
+			err = h.OnSubscriptionChange(ctx, e)
+		}
+	case *InboundEvent:
+		if h.OnInbound != nil {
+			err = h.OnInbound(ctx, e)
+		}
+	default:
+		return fmt.Errorf("%w: %T", ErrUnknownWebhookRecordType, event)
+	}
+	return err
+}
+
+// authorized checks the basic auth credentials and headers of r in constant time
+func (h *WebhookHandler) authorized(r *http.Request) bool {
+	ok := true
+	if h.HTTPAuth != nil {
+		username, password, found := r.BasicAuth()
+		ok = found &&
+			subtle.ConstantTimeCompare([]byte(username), []byte(h.HTTPAuth.Username)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(h.HTTPAuth.Password)) == 1
+	}
+	for _, header := range h.HTTPHeaders {
+		values := r.Header.Values(header.Name)
+		ok = ok && len(values) == 1 && subtle.ConstantTimeCompare([]byte(values[0]), []byte(header.Value)) == 1
+	}
+	return ok
+}
+
+// rejectWebhook answers a request which must not be retried: 403 marks inbound
+// messages as failed, other webhooks are acknowledged
+func rejectWebhook(w http.ResponseWriter, inbound bool) {
+	if inbound {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// looksInbound reports whether a payload which could not be parsed, possibly
+// truncated, is an inbound message, which carries OriginalRecipient
+func looksInbound(body []byte) bool {
+	return bytes.Contains(body, []byte(`"OriginalRecipient"`)) ||
+		bytes.Contains(body, []byte(`"RecordType":"Inbound"`))
+}
+
+func (h *WebhookHandler) retryable(err error) bool {
+	return errors.Is(err, ErrRetryWebhook) || (h.IsRetryable != nil && h.IsRetryable(err))
+}
+
+func (h *WebhookHandler) reportError(r *http.Request, err error) {
+	if h.OnError != nil {
+		h.OnError(r, err)
+	}
+}
@@ -0,0 +1,369 @@
+package postmark
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// PostmarkWebhookRetrySchedule is the delay before each retry of a webhook
+// Postmark could not deliver
+var PostmarkWebhookRetrySchedule = []time.Duration{
+	time.Minute, 5 * time.Minute, 10 * time.Minute, 10 * time.Minute, 10 * time.Minute,
+	15 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour, 6 * time.Hour,
+}
+
+// webhookResponseBodyLimit bounds the response body kept by a WebhookAttempt
+const webhookResponseBodyLimit = 4 << 10
+
+// WebhookAttempt is a single POST of a webhook payload
+type WebhookAttempt struct {
+	// At: time the request was sent
+	At time.Time
+	// StatusCode of the response, 0 when the request failed
+	StatusCode int
+	// Latency until the response headers were received
+	Latency time.Duration
+	// Body: beginning of the response body
+	Body string
+	// Err: transport error, such as a refused connection or a TLS error
+	Err error
+}
+
+// Accepted reports whether Postmark would consider the webhook delivered
+func (a WebhookAttempt) Accepted() bool {
+	return a.Err == nil && a.StatusCode == http.StatusOK
+}
+
+// WebhookDelivery reports the delivery of an event by a WebhookSimulator
+type WebhookDelivery struct {
+	Event    WebhookEvent
+	Attempts []WebhookAttempt
+	// Delivered: an attempt was accepted
+	Delivered bool
+}
+
+// WebhookSimulator POSTs webhook events to an endpoint the way Postmark does,
+// with the basic auth credentials and headers of a Webhook, retrying
+// deliveries which are not answered with 200. It is meant to test webhook
+// consumers locally, see SampleWebhookEvent and MessageWebhookEvents.
+type WebhookSimulator struct {
+	// Webhook provides the URL, HTTPAuth and HTTPHeaders of the requests
+	Webhook Webhook
+	// HTTPClient is &http.Client{} by default
+	HTTPClient *http.Client
+	// RetrySchedule: delays before each retry, none by default. Use
+	// PostmarkWebhookRetrySchedule, or a shortened copy, to simulate retries.
+	RetrySchedule []time.Duration
+}
+
+// NewWebhookSimulator builds a WebhookSimulator posting to url with the
+// credentials and headers of webhook
+func NewWebhookSimulator(webhook Webhook, url string) *WebhookSimulator {
+	if url != "" {
+		webhook.URL = url
+	}
+	return &WebhookSimulator{Webhook: webhook, HTTPClient: &http.Client{}}
+}
+
+// Send delivers event, retrying according to RetrySchedule. Inbound events
+// answered with 403 are not retried, as Postmark does.
+func (s *WebhookSimulator) Send(ctx context.Context, event WebhookEvent) (WebhookDelivery, error) {
+	delivery := WebhookDelivery{Event: event}
+
+	payload, err := webhookPayload(event)
+	if err != nil {
+		return delivery, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		a := postWebhook(ctx, s.HTTPClient, s.Webhook, payload)
+		delivery.Attempts = append(delivery.Attempts, a)
+		if a.Accepted() {
+			delivery.Delivered = true
+			return delivery, nil
+		}
+		if event.Record().Type == InboundRecord && a.StatusCode == http.StatusForbidden {
+			return delivery, nil
+		}
+		if attempt >= len(s.RetrySchedule) {
+			return delivery, nil
+		}
+
+		timer := time.NewTimer(s.RetrySchedule[attempt])
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return delivery, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// SendAll delivers events in order, stopping at the first error
+func (s *WebhookSimulator) SendAll(ctx context.Context, events []WebhookEvent) ([]WebhookDelivery, error) {
+	deliveries := make([]WebhookDelivery, 0, len(events))
+	for _, event := range events {
+		delivery, err := s.Send(ctx, event)
+		deliveries = append(deliveries, delivery)
+		if err != nil {
+			return deliveries, err
+		}
+	}
+	return deliveries, nil
+}
+
+// Replay fetches an outbound message and delivers its MessageEvents as
+// webhooks, see MessageWebhookEvents. Bounces are fetched with GetBounce to
+// replay their actual type, and are replayed as hard bounces when the lookup
+// fails.
+func (s *WebhookSimulator) Replay(ctx context.Context, client *Client, messageID string) ([]WebhookDelivery, error) {
+	msg, err := client.GetOutboundMessage(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	events := MessageWebhookEvents(msg, s.Webhook.MessageStream)
+	for i, event := range events {
+		bounce, ok := event.(*BounceEvent)
+		if !ok || bounce.ID == 0 {
+			continue
+		}
+		if b, err := client.GetBounce(ctx, bounce.ID); err == nil {
+			events[i] = BounceWebhookEvent(b, s.Webhook.MessageStream)
+		}
+	}
+	return s.SendAll(ctx, events)
+}
+
+// postWebhook POSTs payload to the URL of webhook with its credentials and headers
+func postWebhook(ctx context.Context, client *http.Client, webhook Webhook, payload []byte) WebhookAttempt {
+	a := WebhookAttempt{At: time.Now()}
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		a.Err = err
+		return a
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Postmark")
+	if webhook.HTTPAuth != nil {
+		req.SetBasicAuth(webhook.HTTPAuth.Username, webhook.HTTPAuth.Password)
+	}
+	for _, header := range webhook.HTTPHeaders {
+		req.Header.Set(header.Name, header.Value)
+	}
+
+	res, err := client.Do(req)
+	a.Latency = time.Since(a.At)
+	if err != nil {
+		a.Err = err
+		return a
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	a.StatusCode = res.StatusCode
+	body, err := io.ReadAll(io.LimitReader(res.Body, webhookResponseBodyLimit))
+	a.Body = string(body)
+	if err != nil {
+		a.Err = err
+	}
+	return a
+}
+
+// webhookPayload encodes event, setting its RecordType when missing
+func webhookPayload(event WebhookEvent) ([]byte, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	var payload map[string]interface{}
+	if err = json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+	if recordType, _ := payload["RecordType"].(string); recordType == "" {
+		payload["RecordType"] = string(event.Record().Type)
+	}
+	return json.Marshal(payload)
+}
+
+// randomUUID returns a random UUID formatted like Postmark message IDs
+func randomUUID() string {
+	h := randomHex(16)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// SampleWebhookEvent returns a realistic event of the record type, for a new
+// message to john@example.com sent now
+func SampleWebhookEvent(recordType WebhookRecordType) (WebhookEvent, error) {
+	now := time.Now().UTC()
+	messageID := randomUUID()
+	metadata := map[string]string{"example": "value"}
+	client := WebhookClient{Name: "Chrome 120.0.0.0", Company: "Google", Family: "Chrome"}
+	osClient := WebhookClient{Name: "OS X 10.15 Catalina", Company: "Apple Computer, Inc.", Family: "OS X 10"}
+	geo := WebhookGeo{
+		CountryISOCode: "RS", Country: "Serbia", RegionISOCode: "VO", Region: "Autonomna Pokrajina Vojvodina",
+		City: "Novi Sad", Zip: "21000", Coords: "45.2517,19.8369", IP: "188.2.95.4",
+	}
+	userAgent := "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+	switch recordType {
+	case DeliveryRecord:
+		return &DeliveryEvent{
+			RecordType: DeliveryRecord, MessageStream: "outbound", ServerID: 23, MessageID: messageID,
+			Recipient: "john@example.com", Tag: "welcome-email", DeliveredAt: now,
+			Details: "smtp;250 2.0.0 OK", Metadata: metadata,
+		}, nil
+	case BounceRecord:
+		return &BounceEvent{
+			RecordType: BounceRecord, MessageStream: "outbound", ID: now.UnixNano() / 1000, Type: HardBounceCode.String(),
+			TypeCode: HardBounceCode, Name: "Hard bounce", Tag: "welcome-email", MessageID: messageID, ServerID: 23,
+			Description: "The server was unable to deliver your message (ex: unknown user, mailbox not found).",
+			Details:     "smtp;550 5.1.1 The email account that you tried to reach does not exist.",
+			Email:       "john@example.com", From: "sender@example.com", BouncedAt: now, DumpAvailable: true,
+			Inactive: true, CanActivate: true, Subject: "Welcome", Metadata: metadata,
+		}, nil
+	case SpamComplaintRecord:
+		return &SpamComplaintEvent{
+			RecordType: SpamComplaintRecord, MessageStream: "outbound", ID: now.UnixNano() / 1000, Type: SpamComplaintCode.String(),
+			TypeCode: SpamComplaintCode, Name: "Spam complaint", Tag: "welcome-email", MessageID: messageID, ServerID: 23,
+			Description: "The subscriber explicitly marked this message as spam.", Details: "Test spam complaint details",
+			Email: "john@example.com", From: "sender@example.com", BouncedAt: now, DumpAvailable: true,
+			Inactive: true, CanActivate: false, Subject: "Welcome", Metadata: metadata,
+		}, nil
+	case OpenRecord:
+		return &OpenEvent{
+			RecordType: OpenRecord, MessageStream: "outbound", FirstOpen: true, Client: client, OS: osClient,
+			Platform: "Desktop", UserAgent: userAgent, ReadSeconds: 5, Geo: geo, MessageID: messageID,
+			ReceivedAt: now, Tag: "welcome-email", Recipient: "john@example.com", Metadata: metadata,
+		}, nil
+	case ClickRecord:
+		return &ClickEvent{
+			RecordType: ClickRecord, MessageStream: "outbound", ClickLocation: "HTML", Client: client, OS: osClient,
+			Platform: "Desktop", UserAgent: userAgent, OriginalLink: "https://example.com", Geo: geo,
+			MessageID: messageID, ReceivedAt: now, Tag: "welcome-email", Recipient: "john@example.com", Metadata: metadata,
+		}, nil
+	case SubscriptionChangeRecord:
+		return &SubscriptionChangeEvent{
+			RecordType: SubscriptionChangeRecord, MessageStream: "outbound", MessageID: messageID, ServerID: 23,
+			ChangedAt: now, Recipient: "john@example.com", Origin: "Recipient", SuppressSending: true,
+			SuppressionReason: "HardBounce", Tag: "welcome-email", Metadata: metadata,
+		}, nil
+	case InboundRecord:
+		event := &InboundEvent{RecordType: InboundRecord}
+		event.From = "support@example.com"
+		event.FromName = "Example Support"
+		event.FromFull = Recipient{Name: "Example Support", Email: "support@example.com"}
+		event.To = "yourhash+SampleHash@inbound.postmarkapp.com"
+		event.ToFull = []Recipient{{Email: event.To}}
+		event.OriginalRecipient = event.To
+		event.MailboxHash = "SampleHash"
+		event.Subject = "Test subject"
+		event.Date = now.Format(time.RFC1123Z)
+		event.TextBody = "This is a test text body."
+		event.HTMLBody = "<html><body><p>This is a test html body.</p></body></html>"
+		event.StrippedTextReply = "This is the reply text"
+		event.MessageID = messageID
+		event.MessageStream = "inbound"
+		event.Headers = []Header{{Name: "X-Spam-Status", Value: "No"}, {Name: "Message-ID", Value: "<" + messageID + "@example.com>"}}
+		return event, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownWebhookRecordType, recordType)
+}
+
+// BounceWebhookEvent converts a bounce fetched with GetBounce into its webhook event
+func BounceWebhookEvent(bounce Bounce, messageStream string) WebhookEvent {
+	event := BounceEvent{
+		RecordType: BounceRecord, MessageStream: messageStream, ID: bounce.ID, Type: bounce.Type,
+		TypeCode: BounceTypeCode(bounce.TypeCode), Name: bounce.Name, Tag: bounce.Tag, MessageID: bounce.MessageID,
+		Description: bounce.Description, Details: bounce.Details, Email: bounce.Email, BouncedAt: bounce.BouncedAt,
+		DumpAvailable: bounce.DumpAvailable, Inactive: bounce.Inactive, CanActivate: bounce.CanActivate,
+		Subject: bounce.Subject,
+	}
+	if event.TypeCode == SpamComplaintCode {
+		event.RecordType = SpamComplaintRecord
+		spam := SpamComplaintEvent(event)
+		return &spam
+	}
+	return &event
+}
+
+// OpenWebhookEvent converts an open fetched with GetOutboundMessageOpens into its webhook event
+func OpenWebhookEvent(open Open, recipient string, receivedAt time.Time, messageStream string) *OpenEvent {
+	return &OpenEvent{
+		RecordType:    OpenRecord,
+		MessageStream: messageStream,
+		FirstOpen:     open.FirstOpen,
+		Client:        WebhookClient{Name: open.Client["Name"], Company: open.Client["Company"], Family: open.Client["Family"]},
+		OS:            WebhookClient{Name: open.OS["Name"], Company: open.OS["Company"], Family: open.OS["Family"]},
+		Platform:      open.Platform,
+		UserAgent:     open.UserAgent,
+		ReadSeconds:   open.ReadSeconds,
+		Geo: WebhookGeo{
+			CountryISOCode: open.Geo["CountryISOCode"], Country: open.Geo["Country"],
+			RegionISOCode: open.Geo["RegionISOCode"], Region: open.Geo["Region"], City: open.Geo["City"],
+			Zip: open.Geo["Zip"], Coords: open.Geo["Coords"], IP: open.Geo["IP"],
+		},
+		MessageID:  open.MessageID,
+		ReceivedAt: receivedAt,
+		Recipient:  recipient,
+	}
+}
+
+// MessageWebhookEvents converts the MessageEvents of an outbound message into
+// the webhook events Postmark posted for them, in order. Events without a
+// webhook, such as Queued, are skipped. MessageEvents do not carry the bounce
+// type, so bounces are converted as hard bounces, see BounceWebhookEvent to
+// convert a bounce fetched with GetBounce.
+func MessageWebhookEvents(msg OutboundMessage, messageStream string) []WebhookEvent {
+	var events []WebhookEvent
+	firstOpen := map[string]bool{}
+
+	for _, me := range msg.MessageEvents {
+		switch me.Type {
+		case "Delivered":
+			events = append(events, &DeliveryEvent{
+				RecordType: DeliveryRecord, MessageStream: messageStream, MessageID: msg.MessageID,
+				Recipient: me.Recipient, Tag: msg.Tag, DeliveredAt: me.ReceivedAt, Details: me.Details["DeliveryMessage"],
+			})
+		case "Bounced":
+			id, _ := strconv.ParseInt(me.Details["BounceID"], 10, 64)
+			events = append(events, &BounceEvent{
+				RecordType: BounceRecord, MessageStream: messageStream, ID: id, Type: HardBounceCode.String(),
+				TypeCode: HardBounceCode, Name: "Hard bounce", Tag: msg.Tag, MessageID: msg.MessageID,
+				Description: me.Details["Summary"], Email: me.Recipient, From: msg.From, BouncedAt: me.ReceivedAt,
+				Subject: msg.Subject,
+			})
+		case "Opened":
+			events = append(events, &OpenEvent{
+				RecordType: OpenRecord, MessageStream: messageStream, FirstOpen: !firstOpen[me.Recipient],
+				MessageID: msg.MessageID, ReceivedAt: me.ReceivedAt, Tag: msg.Tag, Recipient: me.Recipient,
+			})
+			firstOpen[me.Recipient] = true
+		case "LinkClicked":
+			events = append(events, &ClickEvent{
+				RecordType: ClickRecord, MessageStream: messageStream, ClickLocation: me.Details["ClickLocation"],
+				OriginalLink: me.Details["Link"], MessageID: msg.MessageID, ReceivedAt: me.ReceivedAt,
+				Tag: msg.Tag, Recipient: me.Recipient,
+			})
+		case "SubscriptionChanged":
+			suppress, _ := strconv.ParseBool(me.Details["SuppressSending"])
+			events = append(events, &SubscriptionChangeEvent{
+				RecordType: SubscriptionChangeRecord, MessageStream: messageStream, MessageID: msg.MessageID,
+				ChangedAt: me.ReceivedAt, Recipient: me.Recipient, Origin: me.Details["Origin"],
+				SuppressSending: suppress, SuppressionReason: me.Details["SuppressionReason"], Tag: msg.Tag,
+			})
+		}
+	}
+	return events
+}
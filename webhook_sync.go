@@ -0,0 +1,308 @@
+package postmark
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// defaultWebhookStream is the stream of webhooks created without a MessageStream
+const defaultWebhookStream = "outbound"
+
+// redacted replaces secrets in plan output
+const redacted = "<redacted>"
+
+// WebhookSyncAction is what a reconciliation does to a webhook
+type WebhookSyncAction string
+
+const (
+	// WebhookSyncCreate creates a desired webhook missing on the server
+	WebhookSyncCreate WebhookSyncAction = "create"
+	// WebhookSyncUpdate edits a webhook which differs from its desired state
+	WebhookSyncUpdate WebhookSyncAction = "update"
+	// WebhookSyncDelete deletes a webhook which is not desired
+	WebhookSyncDelete WebhookSyncAction = "delete"
+)
+
+// WebhookSyncChange is a single change of a WebhookSyncPlan
+type WebhookSyncChange struct {
+	// Action to perform
+	Action WebhookSyncAction
+	// Desired webhook, nil for deletions
+	Desired *Webhook
+	// Current webhook on the server, nil for creations
+	Current *Webhook
+	// Fields lists the differences, with secrets redacted
+	Fields []string
+}
+
+// WebhookSyncPlan lists the changes reconciling the webhooks of a server
+type WebhookSyncPlan struct {
+	Changes []WebhookSyncChange
+}
+
+// String formats the plan for review. HTTPAuth passwords and header values are
+// never printed, only whether they change.
+func (plan WebhookSyncPlan) String() string {
+	if len(plan.Changes) == 0 {
+		return "No changes.\n"
+	}
+
+	var sb strings.Builder
+	for _, change := range plan.Changes {
+		switch change.Action {
+		case WebhookSyncCreate:
+			fmt.Fprintf(&sb, "+ create %s %s\n", webhookStream(*change.Desired), redactURL(change.Desired.URL))
+		case WebhookSyncUpdate:
+			fmt.Fprintf(&sb, "~ update #%d %s %s\n", change.Current.ID, webhookStream(*change.Current), redactURL(change.Current.URL))
+		case WebhookSyncDelete:
+			fmt.Fprintf(&sb, "- delete #%d %s %s\n", change.Current.ID, webhookStream(*change.Current), redactURL(change.Current.URL))
+		}
+		for _, field := range change.Fields {
+			fmt.Fprintf(&sb, "    %s\n", field)
+		}
+	}
+	return sb.String()
+}
+
+// WebhookReconciler makes the webhooks of a server match a desired
+// configuration. Webhooks are matched by MessageStream and URL.
+type WebhookReconciler struct {
+	// Client of the server
+	Client *Client
+	// Delete removes the webhooks which are not desired, on the message streams
+	// having a desired webhook
+	Delete bool
+}
+
+// Plan compares desired with the webhooks of the server
+func (r *WebhookReconciler) Plan(ctx context.Context, desired []Webhook) (WebhookSyncPlan, error) {
+	plan := WebhookSyncPlan{}
+
+	current, err := r.Client.ListWebhooks(ctx, "")
+	if err != nil {
+		return plan, err
+	}
+
+	streams := map[string]bool{}
+	matched := map[int]bool{}
+	for i := range desired {
+		d := desired[i]
+		d.ID = 0
+		streams[webhookStream(d)] = true
+
+		var match *Webhook
+		for j := range current {
+			c := current[j]
+			if !matched[c.ID] && webhookStream(c) == webhookStream(d) && c.URL == d.URL {
+				match = &c
+				matched[c.ID] = true
+				break
+			}
+		}
+
+		if match == nil {
+			plan.Changes = append(plan.Changes, WebhookSyncChange{
+				Action:  WebhookSyncCreate,
+				Desired: &d,
+				Fields:  webhookDiff(Webhook{}, d),
+			})
+			continue
+		}
+		if fields := webhookDiff(*match, d); len(fields) > 0 {
+			plan.Changes = append(plan.Changes, WebhookSyncChange{
+				Action:  WebhookSyncUpdate,
+				Desired: &d,
+				Current: match,
+				Fields:  fields,
+			})
+		}
+	}
+
+	if r.Delete {
+		for i := range current {
+			c := current[i]
+			if !matched[c.ID] && streams[webhookStream(c)] {
+				plan.Changes = append(plan.Changes, WebhookSyncChange{Action: WebhookSyncDelete, Current: &c})
+			}
+		}
+	}
+	return plan, nil
+}
+
+// Apply performs the changes of plan in order
+func (r *WebhookReconciler) Apply(ctx context.Context, plan WebhookSyncPlan) error {
+	for _, change := range plan.Changes {
+		var err error
+		switch change.Action {
+		case WebhookSyncCreate:
+			_, err = r.Client.CreateWebhook(ctx, *change.Desired)
+		case WebhookSyncUpdate:
+			err = r.editWebhook(ctx, change.Current.ID, *change.Desired)
+		case WebhookSyncDelete:
+			err = r.Client.DeleteWebhook(ctx, change.Current.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("%s webhook %s: %w", change.Action, redactURL(webhookURL(change)), err)
+		}
+	}
+	return nil
+}
+
+// Sync plans and applies the changes reconciling the server with desired
+func (r *WebhookReconciler) Sync(ctx context.Context, desired []Webhook) (WebhookSyncPlan, error) {
+	plan, err := r.Plan(ctx, desired)
+	if err != nil {
+		return plan, err
+	}
+	return plan, r.Apply(ctx, plan)
+}
+
+// webhookEdit is the payload of an update. HttpAuth and HttpHeaders are always
+// sent, empty ones clearing those of the server, which Webhook omits.
+type webhookEdit struct {
+	URL         string           `json:"Url"`
+	HTTPAuth    *WebhookHTTPAuth `json:"HttpAuth"`
+	HTTPHeaders []Header         `json:"HttpHeaders"`
+	Triggers    WebhookTrigger   `json:"Triggers"`
+}
+
+// editWebhook replaces the settings of the webhook with the given ID by those of desired
+func (r *WebhookReconciler) editWebhook(ctx context.Context, id int, desired Webhook) error {
+	edit := webhookEdit{
+		URL:         desired.URL,
+		HTTPAuth:    desired.HTTPAuth,
+		HTTPHeaders: desired.HTTPHeaders,
+		Triggers:    desired.Triggers,
+	}
+	if edit.HTTPAuth == nil {
+		edit.HTTPAuth = &WebhookHTTPAuth{}
+	}
+	if edit.HTTPHeaders == nil {
+		edit.HTTPHeaders = []Header{}
+	}
+
+	var res Webhook
+	return r.Client.doRequest(ctx, parameters{
+		Method:    http.MethodPut,
+		Path:      fmt.Sprintf("webhooks/%d", id),
+		Payload:   edit,
+		TokenType: serverToken,
+	}, &res)
+}
+
+func webhookURL(change WebhookSyncChange) string {
+	if change.Desired != nil {
+		return change.Desired.URL
+	}
+	return change.Current.URL
+}
+
+// redactURL hides the password of URLs carrying credentials
+func redactURL(rawURL string) string {
+	scheme, rest, ok := strings.Cut(rawURL, "://")
+	if !ok {
+		return rawURL
+	}
+	at := strings.IndexByte(rest, '@')
+	slash := strings.IndexByte(rest, '/')
+	if at < 0 || (slash >= 0 && slash < at) {
+		return rawURL
+	}
+	user, _, _ := strings.Cut(rest[:at], ":")
+	return scheme + "://" + user + ":" + redacted + rest[at:]
+}
+
+// webhookStream returns the stream of a webhook, defaulting as Postmark does
+func webhookStream(webhook Webhook) string {
+	if webhook.MessageStream == "" {
+		return defaultWebhookStream
+	}
+	return webhook.MessageStream
+}
+
+// webhookTriggerFlag is a named boolean setting of a WebhookTrigger
+type webhookTriggerFlag struct {
+	name  string
+	value bool
+}
+
+// webhookTriggerFlags lists the flags of triggers by name
+func webhookTriggerFlags(triggers WebhookTrigger) []webhookTriggerFlag {
+	return []webhookTriggerFlag{
+		{"Open.Enabled", triggers.Open.Enabled},
+		{"Open.PostFirstOpenOnly", triggers.Open.PostFirstOpenOnly},
+		{"Click.Enabled", triggers.Click.Enabled},
+		{"Delivery.Enabled", triggers.Delivery.Enabled},
+		{"Bounce.Enabled", triggers.Bounce.Enabled},
+		{"Bounce.IncludeContent", triggers.Bounce.IncludeContent},
+		{"SpamComplaint.Enabled", triggers.SpamComplaint.Enabled},
+		{"SpamComplaint.IncludeContent", triggers.SpamComplaint.IncludeContent},
+		{"SubscriptionChange.Enabled", triggers.SubscriptionChange.Enabled},
+	}
+}
+
+// webhookDiff describes the differences from current to desired, redacting secrets
+func webhookDiff(current, desired Webhook) []string {
+	var fields []string
+
+	if current.URL != desired.URL {
+		fields = append(fields, fmt.Sprintf("Url: %q -> %q", redactURL(current.URL), redactURL(desired.URL)))
+	}
+
+	var currentAuth, desiredAuth WebhookHTTPAuth
+	if current.HTTPAuth != nil {
+		currentAuth = *current.HTTPAuth
+	}
+	if desired.HTTPAuth != nil {
+		desiredAuth = *desired.HTTPAuth
+	}
+	if currentAuth.Username != desiredAuth.Username {
+		fields = append(fields, fmt.Sprintf("HttpAuth.Username: %q -> %q", currentAuth.Username, desiredAuth.Username))
+	}
+	switch {
+	case currentAuth.Password == desiredAuth.Password:
+	case desiredAuth.Password == "":
+		fields = append(fields, "HttpAuth.Password: removed")
+	case currentAuth.Password == "":
+		fields = append(fields, "HttpAuth.Password: set to "+redacted)
+	default:
+		fields = append(fields, "HttpAuth.Password: changed to "+redacted)
+	}
+
+	currentHeaders := map[string]string{}
+	for _, header := range current.HTTPHeaders {
+		currentHeaders[header.Name] = header.Value
+	}
+	desiredHeaders := map[string]string{}
+	for _, header := range desired.HTTPHeaders {
+		desiredHeaders[header.Name] = header.Value
+	}
+	var headerFields []string
+	for name, value := range desiredHeaders {
+		old, ok := currentHeaders[name]
+		switch {
+		case !ok:
+			headerFields = append(headerFields, fmt.Sprintf("HttpHeaders[%s]: set to %s", name, redacted))
+		case old != value:
+			headerFields = append(headerFields, fmt.Sprintf("HttpHeaders[%s]: changed to %s", name, redacted))
+		}
+	}
+	for name := range currentHeaders {
+		if _, ok := desiredHeaders[name]; !ok {
+			headerFields = append(headerFields, fmt.Sprintf("HttpHeaders[%s]: removed", name))
+		}
+	}
+	sort.Strings(headerFields)
+	fields = append(fields, headerFields...)
+
+	currentFlags, desiredFlags := webhookTriggerFlags(current.Triggers), webhookTriggerFlags(desired.Triggers)
+	for i := range currentFlags {
+		if currentFlags[i].value != desiredFlags[i].value {
+			fields = append(fields, fmt.Sprintf("Triggers.%s: %t -> %t", currentFlags[i].name, currentFlags[i].value, desiredFlags[i].value))
+		}
+	}
+	return fields
+}